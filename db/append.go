@@ -0,0 +1,121 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"strconv"
+	"time"
+)
+
+// crockford is the alphabet of the ids made by idGenerator, which sort in the order they were made.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// idGenerator makes ULID-like ids: 48 bits of milliseconds since the epoch followed by 80 random bits, written as 26
+// characters. Ids made within the same millisecond increment the random bits, so they still sort in order.
+type idGenerator struct {
+	ms      uint64
+	entropy [10]byte
+}
+
+func (g *idGenerator) next(now time.Time) string {
+	ms := uint64(now.UnixNano() / int64(time.Millisecond))
+	if ms > g.ms {
+		g.ms = ms
+		rand.Read(g.entropy[:])
+	} else {
+		for i := len(g.entropy) - 1; i >= 0; i-- {
+			g.entropy[i]++
+			if g.entropy[i] != 0 {
+				break
+			}
+		}
+	}
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], g.ms<<16)
+	copy(b[6:], g.entropy[:])
+	id := make([]byte, 26)
+	// The 128 bits are read 5 at a time from the most significant end, after 2 bits of padding.
+	for i := range id {
+		bit := i*5 - 2
+		v := 0
+		for j := 0; j < 5; j++ {
+			if k := bit + j; k >= 0 && b[k/8]&(0x80>>uint(k%8)) != 0 {
+				v |= 1 << uint(4-j)
+			}
+		}
+		id[i] = crockford[v]
+	}
+	return string(id)
+}
+
+// handleAppend appends the command's value to the list at the command's path, as an element whose map holds the id
+// and the value at the command's id and value fields. It returns the new stored value and the final index of the
+// element.
+func handleAppend(previous string, c *command, id string) (string, int, error) {
+	s, e := changeMapValue(decodeStored(previous), c.pos, func(n storeValue) (storeValue, error) {
+		return storeValue{M: map[string]storeValue{
+			c.id_field:    storeValue{V: id},
+			c.value_field: storeValue{V: c.set_value},
+		}}, nil
+	})
+	if e != nil {
+		return "", 0, e
+	}
+	l, e := valueAt(s, c.pos[:len(c.pos)-1])
+	if e != nil {
+		return "", 0, e
+	}
+	v, e := encodeStored(s)
+	return v, len(l.L) - 1, e
+}
+
+// Append appends the trailing value to the list at the given key and path, as an element whose map holds a new
+// unique, time ordered id along with the value. The id is stored at the field named by an id-field=NAME option
+// following the key, or at "id", and the value at the field named by a value-field=NAME option, or at "value". It
+// returns the id and the final index of the element.
+func (db *Db) Append(r ...string) (string, int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.append(db.ids.next(time.Now()), r...)
+}
+
+// append appends with a given id, which is logged along with the request so that replay appends the same id.
+func (db *Db) append(id string, r ...string) (string, int, error) {
+	gr := []string{"append"}
+	gr = append(gr, r...)
+	c, e := parseCommand(gr)
+	if e != nil {
+		db.logM("errorappend", e.Error())
+		return "", 0, e
+	}
+	db.expireIfDue(c.top_key)
+	v, i, e := handleAppend(db.d[c.top_key], c, id)
+	if e != nil {
+		db.logM("errorappend", e.Error())
+		return "", 0, e
+	}
+	db.write(c.top_key, v)
+	db.logM("append-id", append([]string{id}, r...)...)
+	return id, i, nil
+}
+
+// Append appends the value to the list at the key, as an element whose map holds the value at "value" and the id
+// generated for it by the server at "id". It returns the id.
+func (c *Client) Append(key, value string) (string, error) {
+	id, _, e := c.AppendWithId(key, value)
+	return id, e
+}
+
+// AppendWithId appends the trailing value to the list at the given key and path, accepting id-field=NAME and
+// value-field=NAME options after the key. It returns the id generated for the element and its final index.
+func (c *Client) AppendWithId(command ...string) (string, int, error) {
+	r, e := c.request(append([]string{"append"}, command...)...)
+	if e != nil {
+		return "", 0, e
+	}
+	i, e := strconv.Atoi(r[2])
+	if e != nil {
+		return "", 0, e
+	}
+	return r[1], i, nil
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestIdGenerator(t *testing.T) {
+	g := idGenerator{}
+	now := time.Unix(1500000000, 0)
+	a := g.next(now)
+	b := g.next(now)
+	c := g.next(now.Add(-time.Second))
+	d := g.next(now.Add(time.Millisecond))
+	assert.Equal(t, 26, len(a))
+	assert.True(t, a < b)
+	assert.True(t, b < c)
+	assert.True(t, c < d)
+	assert.Equal(t, a[:10], b[:10])
+	assert.NotEqual(t, a[:10], d[:10])
+}
+
+func TestAppendParse(t *testing.T) {
+	c, e := parseCommand([]string{"append", "post", "id-field=cid", "->", "comments", "hello"})
+	assert.Nil(t, e)
+	assert.Equal(t, c, &command{
+		ct:      command_append,
+		top_key: "post",
+		pos: []commandValue{
+			commandValue{
+				vt:  valueMap,
+				key: "comments",
+			},
+			commandValue{
+				vt: valueList,
+				lc: listCommand{append: true},
+			},
+		},
+		set_value:   "hello",
+		options:     1,
+		id_field:    "cid",
+		value_field: "value",
+	})
+	c, e = parseCommand([]string{"append", "post", "value-field=text", "id-field=cid", "hello"})
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"cid", "text"}, []string{c.id_field, c.value_field})
+	_, e = parseCommand([]string{"append", "post", "value-field=id", "hello"})
+	assert.NotNil(t, e)
+	_, e = parseCommand([]string{"append", "post"})
+	assert.NotNil(t, e)
+	_, e = parseCommand([]string{"append", "post", "id-field=", "hello"})
+	assert.NotNil(t, e)
+}
+
+func TestAppend(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.Nil(t, db.Cap("post", "->", "comments", "2"))
+	ids := []string{}
+	for i, s := range []string{"first", "second", "third"} {
+		id, index, e := db.Append("post", "id-field=cid", "->", "comments", s)
+		assert.Nil(t, e)
+		assert.Equal(t, []int{0, 1, 1}[i], index)
+		ids = append(ids, id)
+	}
+	_, _, e = db.Append("post", "->", "comments", "+", "5", "nested")
+	assert.NotNil(t, e)
+	v, e := db.Get("post", "->", "comments", "+", "0", "->", "cid")
+	assert.Nil(t, e)
+	assert.Equal(t, ids[1], v)
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	v, e = db.Get("post", "->", "comments", "+", "1", "->", "cid")
+	assert.Nil(t, e)
+	assert.Equal(t, ids[2], v)
+	v, e = db.Get("post", "->", "comments", "+", "1", "->", "value")
+	assert.Nil(t, e)
+	assert.Equal(t, "third", v)
+	v, e = db.GetJSON("post", "->", "comments", "+", "0")
+	assert.Nil(t, e)
+	assert.Equal(t, `{"cid":"`+ids[1]+`","value":"second"}`, v)
+}
+
+func TestClientAppendWithId(t *testing.T) {
+	db, e := NewDb(DbOptionsTest())
+	defer db.Close()
+	assert.Nil(t, e)
+	c, e := NewClient(DefaultClientOptions())
+	defer c.Close()
+	assert.Nil(t, e)
+	id, i, e := c.AppendWithId("thread", "->", "posts", "hi")
+	assert.Nil(t, e)
+	assert.Equal(t, 0, i)
+	v, e := c.Get("thread", "->", "posts", "+", "[id="+id+"]", "->", "value")
+	assert.Nil(t, e)
+	assert.Equal(t, "hi", v)
+}
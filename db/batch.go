@@ -0,0 +1,104 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// MGet gets the values of several top keys at once. Keys which are missing are left out of the result.
+func (db *Db) MGet(keys ...string) map[string]string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	values, hits := db.mget(keys...)
+	m := make(map[string]string, len(keys))
+	for i, k := range keys {
+		if hits[i] {
+			m[k] = values[i]
+		}
+	}
+	return m
+}
+
+// mget gets the value of each key, reporting whether each key was found rather than failing on a miss.
+func (db *Db) mget(keys ...string) ([]string, []bool) {
+	values := make([]string, len(keys))
+	hits := make([]bool, len(keys))
+	for i, k := range keys {
+		v, e := db.get(k)
+		values[i], hits[i] = v, e == nil
+	}
+	return values, hits
+}
+
+// MSet sets several top keys at once, given as alternating keys and values. Either every key is written, or none is.
+func (db *Db) MSet(r ...string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.mset(r...)
+}
+
+func (db *Db) mset(r ...string) error {
+	if len(r) == 0 || len(r)%2 != 0 {
+		e := errors.New(fmt.Sprintf("mset expects pairs of keys and values, saw %d arguments", len(r)))
+		db.logM("errormset", e.Error())
+		return e
+	}
+	staged := map[string]string{}
+	keys := []string{}
+	for i := 0; i < len(r); i += 2 {
+		c, e := parseCommand([]string{"set", r[i], r[i+1]})
+		if e != nil {
+			db.logM("errormset", e.Error())
+			return e
+		}
+		db.expireIfDue(c.top_key)
+		previous, ok := staged[c.top_key]
+		if !ok {
+			previous = db.d[c.top_key]
+			keys = append(keys, c.top_key)
+		}
+		if staged[c.top_key], e = handleSet(previous, c); e != nil {
+			db.logM("errormset", e.Error())
+			return e
+		}
+	}
+	for _, k := range keys {
+		db.write(k, staged[k])
+	}
+	db.logM("mset", r...)
+	return nil
+}
+
+// MGet gets the values of several top keys at once. Keys which are missing are left out of the result.
+func (c *Client) MGet(keys ...string) (map[string]string, error) {
+	r, e := c.request(append([]string{"mget"}, keys...)...)
+	if e != nil {
+		return nil, e
+	}
+	if len(r) != 1+2*len(keys) {
+		return nil, errors.New(fmt.Sprintf("mget reply should hold 2 fields per key, saw %v", r))
+	}
+	m := make(map[string]string, len(keys))
+	for i, k := range keys {
+		if r[1+2*i] == "hit" {
+			m[k] = r[2+2*i]
+		}
+	}
+	return m, nil
+}
+
+// MSet atomically sets the value of every key in the map.
+func (c *Client) MSet(values map[string]string) error {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	command := []string{"mset"}
+	for _, k := range keys {
+		command = append(command, k, values[k])
+	}
+	_, e := c.request(command...)
+	return e
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMGetMSet(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.Nil(t, db.Set("thread:1", "->", "title", "hello"))
+	assert.Nil(t, db.MSet("thread:2", "two", "thread:3", "three", "thread:2", "again"))
+	assert.NotNil(t, db.MSet("thread:4", "four", "thread:5"))
+	assert.Equal(t, map[string]string{
+		"thread:2": "again",
+		"thread:3": "three",
+	}, db.MGet("thread:2", "thread:3", "thread:4"))
+	assert.Nil(t, db.MSet("thread:1", "title"))
+	v, e := db.Get("thread:1", "->", "title")
+	assert.Nil(t, e)
+	assert.Equal(t, "hello", v)
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	assert.Equal(t, map[string]string{
+		"thread:1": `{"V":"title","L":null,"M":{"title":{"V":"hello","L":null,"M":null}}}`,
+		"thread:2": "again",
+	}, db.MGet("thread:1", "thread:2", "thread:5"))
+}
+
+func TestClientMGetMSet(t *testing.T) {
+	db, e := NewDb(DbOptionsTest())
+	defer db.Close()
+	assert.Nil(t, e)
+	c, e := NewClient(DefaultClientOptions())
+	defer c.Close()
+	assert.Nil(t, e)
+	assert.Nil(t, c.MSet(map[string]string{"a": "1", "b": "", "c,d": "3"}))
+	m, e := c.MGet("a", "b", "missing", "c,d")
+	assert.Nil(t, e)
+	assert.Equal(t, map[string]string{"a": "1", "b": "", "c,d": "3"}, m)
+	m, e = c.MGet()
+	assert.Nil(t, e)
+	assert.Empty(t, m)
+	assert.NotNil(t, c.MSet(map[string]string{}))
+}
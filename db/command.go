@@ -1,19 +1,34 @@
 package db
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type commandType int
 type commandValueType int
 
 const (
-	command_set commandType = iota
-	command_get commandType = iota
+	command_set     commandType = iota
+	command_get     commandType = iota
+	command_incr    commandType = iota
+	command_cas     commandType = iota
+	command_setjson commandType = iota
+	command_copy    commandType = iota
+	command_merge   commandType = iota
+	command_cap     commandType = iota
+	command_append  commandType = iota
+	command_sadd    commandType = iota
+	command_smember commandType = iota
+	command_zadd    commandType = iota
+	command_zread   commandType = iota
 )
 
 const (
@@ -26,73 +41,568 @@ type storeValue struct {
 	V string
 	L []storeValue
 	M map[string]storeValue
+	// C caps the list at its newest C elements, when positive.
+	C int `json:",omitempty"`
+	// S holds the members of the value's set, in order.
+	S []string `json:",omitempty"`
+	// Z holds the members of the value's sorted set, by score and then by member.
+	Z []ScoredMember `json:",omitempty"`
+	// T is the type of the string value V, or empty for untyped text. Typed values keep their canonical text in V.
+	T string `json:",omitempty"`
+}
+
+const (
+	typeString = "string"
+	typeInt    = "int"
+	typeFloat  = "float"
+	typeBool   = "bool"
+	typeNull   = "null"
+	// typeBytes values hold binary data as standard base64, which goes through the csv protocol and log unharmed.
+	typeBytes = "bytes"
+)
+
+var valueTypes = map[string]bool{
+	typeString: true, typeInt: true, typeFloat: true, typeBool: true, typeNull: true, typeBytes: true,
+}
+
+// typedValue checks a string value against a type, returning the leaf holding its canonical text. Null leaves hold
+// no text, and only accept an empty value or null.
+func typedValue(v, t string) (storeValue, error) {
+	switch t {
+	case "":
+		return storeValue{V: v}, nil
+	case typeString:
+		return storeValue{V: v, T: t}, nil
+	case typeInt:
+		i, e := strconv.ParseInt(v, 10, 64)
+		if e != nil {
+			return storeValue{}, errors.New("value is not an int: " + v)
+		}
+		return storeValue{V: strconv.FormatInt(i, 10), T: t}, nil
+	case typeFloat:
+		f, e := strconv.ParseFloat(v, 64)
+		if e != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return storeValue{}, errors.New("value is not a finite float: " + v)
+		}
+		return storeValue{V: strconv.FormatFloat(f, 'f', -1, 64), T: t}, nil
+	case typeBool:
+		b, e := strconv.ParseBool(v)
+		if e != nil {
+			return storeValue{}, errors.New("value is not a bool: " + v)
+		}
+		return storeValue{V: strconv.FormatBool(b), T: t}, nil
+	case typeNull:
+		if len(v) != 0 && v != "null" {
+			return storeValue{}, errors.New("null value should be empty or null, saw " + v)
+		}
+		return storeValue{T: t}, nil
+	case typeBytes:
+		b, e := base64.StdEncoding.DecodeString(v)
+		if e != nil {
+			return storeValue{}, errors.New("value is not base64: " + v)
+		}
+		return storeValue{V: base64.StdEncoding.EncodeToString(b), T: t}, nil
+	}
+	return storeValue{}, errors.New("unknown value type " + t)
+}
+
+// scalarJson returns the string value of s as the json type it was given.
+func scalarJson(s storeValue) interface{} {
+	switch s.T {
+	case typeInt, typeFloat:
+		return json.Number(s.V)
+	case typeBool:
+		return s.V == "true"
+	case typeNull:
+		return nil
+	}
+	return s.V
+}
+
+// scalarNumber returns the string value of s as a number, if it is one. Untyped text counts as a number when it
+// parses as one.
+func scalarNumber(s storeValue) (float64, bool) {
+	switch s.T {
+	case "", typeInt, typeFloat:
+		f, e := strconv.ParseFloat(s.V, 64)
+		return f, e == nil
+	}
+	return 0, false
+}
+
+// capped drops the oldest elements of the list which do not fit under its cap.
+func (s storeValue) capped() storeValue {
+	if s.C > 0 && len(s.L) > s.C {
+		s.L = append([]storeValue{}, s.L[len(s.L)-s.C:]...)
+	}
+	return s
 }
 
 type listCommand struct {
 	append bool
 	index  int
+	// all selects every element of the list, for get calls.
+	all bool
+	// filter selects the elements of the list whose map matches it, for get calls.
+	filter *listFilter
+	// key selects the single element of the list whose map holds a value at a field.
+	key *elementKey
+	// cap, when positive, caps the list appended to at its newest cap elements.
+	cap int
+}
+
+// elementKey picks out a list element by a unique field of its map, written [field=value] in place of an index.
+type elementKey struct {
+	field string
+	value string
+}
+
+// find returns the index of the only element of l whose map holds the key's value at the key's field.
+func (k *elementKey) find(l []storeValue) (int, error) {
+	found := -1
+	for i, s := range l {
+		v, ok := s.M[k.field]
+		if !ok || v.V != k.value {
+			continue
+		}
+		if found >= 0 {
+			return -1, errors.New(fmt.Sprintf("several list elements have %s=%s", k.field, k.value))
+		}
+		found = i
+	}
+	if found < 0 {
+		return -1, errors.New(fmt.Sprintf("no list element has %s=%s", k.field, k.value))
+	}
+	return found, nil
+}
+
+// listFilter compares a field of the map of list elements against a value.
+type listFilter struct {
+	field string
+	op    string
+	value string
 }
 
 type commandValue struct {
 	vt  commandValueType
 	key string
 	lc  listCommand
+	// wildcard selects every key of the map, for get calls.
+	wildcard bool
 }
 
 type command struct {
-	ct        commandType
-	pos       []commandValue
-	top_key   string
-	set_value string
+	ct             commandType
+	pos            []commandValue
+	top_key        string
+	set_value      string
+	expected_value string
+	// dest is where copy, move and rename commands write to.
+	dest *command
+	// options counts the option tokens, like if-version=N, between the top key and the path.
+	options       int
+	check_version bool
+	if_version    int64
+	set_ttl       bool
+	// expires_at is the deadline given by an ex=N or exat=UNIXNANOS option, when set_ttl is set.
+	expires_at time.Time
+	// id_field and value_field are the fields of the appended element's map which hold its generated id and its value.
+	id_field    string
+	value_field string
+	// args holds the trailing arguments of sorted set commands, which follow the path.
+	args []string
+	// value_type is the type given to the set value by a type=NAME option, or empty for untyped text.
+	value_type string
+	// sort_field orders the list elements found by a get by a field of their maps, descending if sort_desc is set.
+	sort_field string
+	sort_desc  bool
+	// project keeps only these fields of the maps found by a get.
+	project []string
 }
 
 func handleGet(previous string, c *command) (string, error) {
+	return handleGetFormat(previous, c, envelopeValue, false)
+}
+
+// handleGetJson is like handleGet, but always returns plain json, as described by plainJson.
+func handleGetJson(previous string, c *command) (string, error) {
+	return handleGetFormat(previous, c, plainValue, true)
+}
+
+// handleGetFormat follows a get command's path and formats what it finds. A path with wildcards returns a json
+// array of every match. Otherwise a single string is returned as is, unless quote is set.
+func handleGetFormat(previous string, c *command, format func(match) interface{}, quote bool) (string, error) {
 	s := storeValue{}
+	var j interface{}
 	e := json.NewDecoder(strings.NewReader(previous)).Decode(&s)
 	if e != nil {
-		if len(c.pos) == 0 {
-			return previous, nil
+		if len(c.pos) != 0 {
+			return "", e
+		}
+		j = previous
+	} else {
+		matches, e := lookup(s, c.pos, false)
+		if e != nil {
+			return "", e
+		}
+		matches = c.shape(matches)
+		if hasWildcard(c.pos) {
+			filtered := hasFilter(c.pos)
+			l := make([]interface{}, len(matches))
+			for i, m := range matches {
+				l[i] = format(m)
+				if filtered {
+					l[i] = indexedValue{m.index, l[i]}
+				}
+			}
+			j = l
+		} else {
+			j = format(matches[0])
 		}
+	}
+	if v, ok := j.(string); ok && !quote {
+		return v, nil
+	}
+	b, e := json.Marshal(j)
+	if e != nil {
 		return "", e
 	}
-	for _, v := range c.pos {
+	return string(b), nil
+}
+
+// shape applies the sort and project modifiers of a get to what it found: the matches of a wildcard path, or the
+// elements of a single list, are sorted by a field of their maps, and maps keep only the projected fields.
+func (c *command) shape(matches []match) []match {
+	if len(c.sort_field) == 0 && c.project == nil {
+		return matches
+	}
+	if hasWildcard(c.pos) {
+		sorted := append([]match{}, matches...)
+		if len(c.sort_field) != 0 {
+			sort.SliceStable(sorted, func(i, j int) bool { return c.sortsBefore(sorted[i].s, sorted[j].s) })
+		}
+		for i := range sorted {
+			sorted[i].s = c.projected(sorted[i].s)
+		}
+		return sorted
+	}
+	m := matches[0]
+	if m.s.L == nil {
+		m.s = c.projected(m.s)
+		return []match{m}
+	}
+	l := append([]storeValue{}, m.s.L...)
+	if len(c.sort_field) != 0 {
+		sort.SliceStable(l, func(i, j int) bool { return c.sortsBefore(l[i], l[j]) })
+	}
+	for i := range l {
+		l[i] = c.projected(l[i])
+	}
+	m.s.L = l
+	return []match{m}
+}
+
+// sortsBefore orders two values by the sort field of their maps. Values without the field come last either way.
+func (c *command) sortsBefore(a, b storeValue) bool {
+	x, xok := a.M[c.sort_field]
+	y, yok := b.M[c.sort_field]
+	if !xok || !yok {
+		return xok && !yok
+	}
+	if c.sort_desc {
+		return compareScalars(x, y) > 0
+	}
+	return compareScalars(x, y) < 0
+}
+
+// projected keeps only the projected fields of the map of s.
+func (c *command) projected(s storeValue) storeValue {
+	if c.project == nil || s.M == nil {
+		return s
+	}
+	p := storeValue{M: make(map[string]storeValue, len(c.project))}
+	for _, f := range c.project {
+		if v, ok := s.M[f]; ok {
+			p.M[f] = v
+		}
+	}
+	return p
+}
+
+// match is a value found by following a get path, along with the string or whole list selector which ended the
+// path early, if any.
+type match struct {
+	s    storeValue
+	last *commandValue
+	// index is the position of the match in the list of the innermost filter it went through.
+	index    int
+	filtered bool
+}
+
+// indexedValue is how a match which went through a list filter is returned, along with its index.
+type indexedValue struct {
+	Index int         `json:"index"`
+	Value interface{} `json:"value"`
+}
+
+// envelopeValue formats a match the way get always has: string values as they are, and anything with sub-structure
+// as a storeValue.
+func envelopeValue(m match) interface{} {
+	switch {
+	case m.last != nil && m.last.vt == valueString:
+		return m.s.V
+	case m.last != nil:
+		return m.s.L
+	case len(m.s.M) == 0 && len(m.s.L) == 0 && len(m.s.S) == 0 && len(m.s.Z) == 0:
+		return m.s.V
+	default:
+		return m.s
+	}
+}
+
+func plainValue(m match) interface{} {
+	switch {
+	case m.last != nil && m.last.vt == valueString:
+		return scalarJson(m.s)
+	case m.last != nil:
+		l := make([]interface{}, len(m.s.L))
+		for i, v := range m.s.L {
+			l[i] = plainJson(v)
+		}
+		return l
+	default:
+		return plainJson(m.s)
+	}
+}
+
+// lookup follows a get command's path from s, fanning out over every list element and map key at wildcards. Once
+// fanned out, missing keys and indexes are no match rather than an empty value or an error.
+func lookup(s storeValue, pos []commandValue, fanned bool) ([]match, error) {
+	for i, v := range pos {
 		switch v.vt {
 		case valueString:
-			return s.V, nil
+			return []match{{s: s, last: &pos[i]}}, nil
 		case valueList:
-			if v.lc.index < 0 {
-				b, e := json.Marshal(s.L)
+			if v.lc.all || v.lc.filter != nil {
+				matches := []match{}
+				for j, l := range s.L {
+					if v.lc.filter != nil && !v.lc.filter.matches(l) {
+						continue
+					}
+					m, e := lookup(l, pos[i+1:], true)
+					if e != nil {
+						return nil, e
+					}
+					// The innermost filter decides the index of a match.
+					for k := range m {
+						if v.lc.filter != nil && !m[k].filtered {
+							m[k].index = j
+							m[k].filtered = true
+						}
+					}
+					matches = append(matches, m...)
+				}
+				return matches, nil
+			}
+			if v.lc.key != nil {
+				j, e := v.lc.key.find(s.L)
 				if e != nil {
-					return "", e
+					if fanned {
+						return nil, nil
+					}
+					return nil, e
 				}
-				return string(b), nil
+				s = s.L[j]
+				continue
 			}
-			if v.lc.index < 0 || v.lc.index >= len(s.L) {
-				return "", errors.New(fmt.Sprintf("index request out of range: %d vs %d", v.lc.index, len(s.L)))
+			if v.lc.index < 0 {
+				return []match{{s: s, last: &pos[i]}}, nil
+			}
+			if v.lc.index >= len(s.L) {
+				if fanned {
+					return nil, nil
+				}
+				return nil, errors.New(fmt.Sprintf("index request out of range: %d vs %d", v.lc.index, len(s.L)))
 			}
 			s = s.L[v.lc.index]
-			break
 		case valueMap:
-			s = s.M[v.key]
-			break
+			if v.wildcard {
+				keys := make([]string, 0, len(s.M))
+				for k := range s.M {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				matches := []match{}
+				for _, k := range keys {
+					m, e := lookup(s.M[k], pos[i+1:], true)
+					if e != nil {
+						return nil, e
+					}
+					matches = append(matches, m...)
+				}
+				return matches, nil
+			}
+			nv, ok := s.M[v.key]
+			if !ok && fanned {
+				return nil, nil
+			}
+			s = nv
 		default:
-			return "", errors.New("unexpected value type")
+			return nil, errors.New("unexpected value type")
 		}
 	}
-	if len(s.M) == 0 && len(s.L) == 0 {
-		return s.V, nil
+	return []match{{s: s}}, nil
+}
+
+func hasWildcard(pos []commandValue) bool {
+	for _, v := range pos {
+		if v.wildcard || v.lc.all || v.lc.filter != nil {
+			return true
+		}
 	}
-	b, e := json.Marshal(s)
-	if e != nil {
-		return "", e
+	return false
+}
+
+func hasFilter(pos []commandValue) bool {
+	for _, v := range pos {
+		if v.lc.filter != nil {
+			return true
+		}
 	}
-	return string(b), nil
+	return false
+}
+
+var filterOps = map[string]bool{"=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+// matches reports whether the filter's field of s compares to the filter's value as the filter's operator asks.
+// Elements without the field never match.
+func (f *listFilter) matches(s storeValue) bool {
+	v, ok := s.M[f.field]
+	if !ok {
+		return false
+	}
+	c := compareScalars(v, storeValue{V: f.value})
+	switch f.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// compareScalars compares the string values of two leaves as numbers if both are numbers, and as text otherwise.
+// Null compares as the text null, and values typed as strings never compare as numbers.
+func compareScalars(a, b storeValue) int {
+	x, ax := scalarNumber(a)
+	y, bx := scalarNumber(b)
+	if !ax || !bx {
+		return strings.Compare(scalarText(a), scalarText(b))
+	}
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func scalarText(s storeValue) string {
+	if s.T == typeNull {
+		return "null"
+	}
+	return s.V
 }
 
-func changeMapValue(previous storeValue, pos []commandValue, v string) (storeValue, error) {
+// plainJson converts a storeValue into natural json: a value holding only a map becomes an object, one holding only
+// a list becomes an array, and anything else becomes its string value. A value holding more than one of these
+// becomes an object keyed by the tokens which address them in the path grammar: "_" for the string value, "+" for
+// the list and "->" for the map. Typed string values become the json type they were given. A set becomes an array of
+// its members and a sorted set an array of its scored members. In a mixed object, sets are keyed by "{}" and sorted
+// sets by "<>".
+func plainJson(s storeValue) interface{} {
+	parts := 0
+	if len(s.V) != 0 || s.T == typeNull {
+		parts++
+	}
+	if len(s.S) != 0 {
+		parts++
+	}
+	if len(s.Z) != 0 {
+		parts++
+	}
+	var l []interface{}
+	if s.L != nil {
+		parts++
+		l = make([]interface{}, len(s.L))
+		for i, v := range s.L {
+			l[i] = plainJson(v)
+		}
+	}
+	var m map[string]interface{}
+	if s.M != nil {
+		parts++
+		m = make(map[string]interface{}, len(s.M))
+		for k, v := range s.M {
+			m[k] = plainJson(v)
+		}
+	}
+	switch {
+	case parts > 1:
+		mixed := map[string]interface{}{}
+		if len(s.V) != 0 || s.T == typeNull {
+			mixed["_"] = scalarJson(s)
+		}
+		if l != nil {
+			mixed["+"] = l
+		}
+		if m != nil {
+			mixed["->"] = m
+		}
+		if len(s.S) != 0 {
+			mixed["{}"] = s.S
+		}
+		if len(s.Z) != 0 {
+			mixed["<>"] = s.Z
+		}
+		return mixed
+	case l != nil:
+		return l
+	case m != nil:
+		return m
+	case len(s.S) != 0:
+		return s.S
+	case len(s.Z) != 0:
+		return s.Z
+	default:
+		return scalarJson(s)
+	}
+}
+
+// leafChange rewrites the value found at the end of a command path.
+type leafChange func(storeValue) (storeValue, error)
+
+// setLeaf returns a leafChange which replaces the string value at the end of a path, along with its type.
+func setLeaf(v storeValue) leafChange {
+	return func(s storeValue) (storeValue, error) {
+		s.V = v.V
+		s.T = v.T
+		return s, nil
+	}
+}
+
+func changeMapValue(previous storeValue, pos []commandValue, f leafChange) (storeValue, error) {
 	if len(pos) == 0 {
-		previous.V = v
-		return previous, nil
+		return f(previous)
 	}
 	p := pos[0]
 	switch p.vt {
@@ -100,18 +610,30 @@ func changeMapValue(previous storeValue, pos []commandValue, v string) (storeVal
 		if len(pos[1:]) > 0 {
 			return previous, errors.New("leftover positional arguments in set command")
 		}
-		previous.V = v
-		return previous, nil
+		return f(previous)
 	case valueList:
 		if p.lc.append {
-			nv, e := changeNewValue(pos[1:], v)
+			nv, e := changeNewValue(pos[1:], f)
 			if e != nil {
 				return previous, e
 			}
 			previous.L = append(previous.L, nv)
-			return previous, nil
+			if p.lc.cap > 0 {
+				previous.C = p.lc.cap
+			}
+			return previous.capped(), nil
 		}
-		nv, e := changeMapValue(previous.L[p.lc.index], pos[1:], v)
+		if p.lc.key != nil {
+			i, e := p.lc.key.find(previous.L)
+			if e != nil {
+				return previous, e
+			}
+			p.lc.index = i
+		}
+		if p.lc.index < 0 || p.lc.index >= len(previous.L) {
+			return previous, errors.New(fmt.Sprintf("index request out of range: %d vs %d", p.lc.index, len(previous.L)))
+		}
+		nv, e := changeMapValue(previous.L[p.lc.index], pos[1:], f)
 		if e != nil {
 			return previous, e
 		}
@@ -120,14 +642,14 @@ func changeMapValue(previous storeValue, pos []commandValue, v string) (storeVal
 	case valueMap:
 		nv, ok := previous.M[p.key]
 		if ok {
-			nv, e := changeMapValue(nv, pos[1:], v)
+			nv, e := changeMapValue(nv, pos[1:], f)
 			if e != nil {
 				return previous, e
 			}
 			previous.M[p.key] = nv
 			return previous, nil
 		}
-		nv, e := changeNewValue(pos[1:], v)
+		nv, e := changeNewValue(pos[1:], f)
 		if e != nil {
 			return previous, e
 		}
@@ -140,25 +662,120 @@ func changeMapValue(previous storeValue, pos []commandValue, v string) (storeVal
 		return previous, errors.New("do not understand set value type")
 	}
 }
-func changeNewValue(pos []commandValue, s string) (storeValue, error) {
-	return changeMapValue(storeValue{}, pos, s)
+func changeNewValue(pos []commandValue, f leafChange) (storeValue, error) {
+	return changeMapValue(storeValue{}, pos, f)
 }
 
 func handleSet(previous string, c *command) (string, error) {
+	v, e := typedValue(c.set_value, c.value_type)
+	if e != nil {
+		return "", e
+	}
 	s := storeValue{}
 	if len(previous) != 0 {
 		e := json.NewDecoder(strings.NewReader(previous)).Decode(&s)
 		if e != nil {
-			if len(c.pos) == 0 {
+			if len(c.pos) != 0 {
+				return "", e
+			}
+			if len(c.value_type) == 0 {
 				return c.set_value, nil
 			}
+			s = storeValue{}
+		}
+	}
+	s, e = changeMapValue(s, c.pos, setLeaf(v))
+	if e != nil {
+		return "", e
+	}
+	b, e := json.Marshal(s)
+	if e != nil {
+		return "", e
+	}
+	return string(b), nil
+}
+
+// handleSetJson replaces the structure at the command's path with the json document held by the command.
+func handleSetJson(previous string, c *command) (string, error) {
+	j, e := decodeJson(c.set_value)
+	if e != nil {
+		return "", e
+	}
+	nv, e := fromJson(j)
+	if e != nil {
+		return "", e
+	}
+	s := storeValue{}
+	if len(previous) != 0 {
+		if e := json.NewDecoder(strings.NewReader(previous)).Decode(&s); e != nil && len(c.pos) != 0 {
 			return "", e
 		}
 	}
-	s, e := changeMapValue(s, c.pos, c.set_value)
+	s, e = changeMapValue(s, c.pos, func(storeValue) (storeValue, error) {
+		return nv, nil
+	})
+	if e != nil {
+		return "", e
+	}
+	b, e := json.Marshal(s)
 	if e != nil {
 		return "", e
 	}
+	return string(b), nil
+}
+
+// fromJson converts a decoded json document into a storeValue: objects become maps, arrays become lists, and
+// strings, numbers and booleans become string values. Numbers are typed as ints or floats and booleans as bools,
+// while null becomes an empty value typed as null.
+func fromJson(j interface{}) (storeValue, error) {
+	switch j := j.(type) {
+	case nil:
+		return storeValue{T: typeNull}, nil
+	case string:
+		return storeValue{V: j}, nil
+	case json.Number:
+		if _, e := j.Int64(); e == nil {
+			return storeValue{V: j.String(), T: typeInt}, nil
+		}
+		return typedValue(j.String(), typeFloat)
+	case bool:
+		return storeValue{V: strconv.FormatBool(j), T: typeBool}, nil
+	case []interface{}:
+		s := storeValue{L: make([]storeValue, len(j))}
+		for i, v := range j {
+			var e error
+			if s.L[i], e = fromJson(v); e != nil {
+				return s, e
+			}
+		}
+		return s, nil
+	case map[string]interface{}:
+		s := storeValue{M: make(map[string]storeValue, len(j))}
+		for k, v := range j {
+			var e error
+			if s.M[k], e = fromJson(v); e != nil {
+				return s, e
+			}
+		}
+		return s, nil
+	default:
+		return storeValue{}, errors.New(fmt.Sprintf("unexpected json value %v", j))
+	}
+}
+
+// decodeStored decodes a stored top key, treating a value which is not json as a plain string value.
+func decodeStored(previous string) storeValue {
+	s := storeValue{}
+	if len(previous) == 0 {
+		return s
+	}
+	if e := json.NewDecoder(strings.NewReader(previous)).Decode(&s); e != nil {
+		return storeValue{V: previous}
+	}
+	return s
+}
+
+func encodeStored(s storeValue) (string, error) {
 	b, e := json.Marshal(s)
 	if e != nil {
 		return "", e
@@ -166,6 +783,213 @@ func handleSet(previous string, c *command) (string, error) {
 	return string(b), nil
 }
 
+// valueAt returns the single value at a path, which may not fan out.
+func valueAt(s storeValue, pos []commandValue) (storeValue, error) {
+	matches, e := lookup(s, pos, false)
+	if e != nil {
+		return s, e
+	}
+	m := matches[0]
+	switch {
+	case m.last != nil && m.last.vt == valueString:
+		return storeValue{V: m.s.V, T: m.s.T}, nil
+	case m.last != nil:
+		return storeValue{L: m.s.L}, nil
+	}
+	return m.s, nil
+}
+
+// cloneValue deeply copies a storeValue, so that it can be written elsewhere in the tree it came from.
+func cloneValue(s storeValue) storeValue {
+	c := storeValue{V: s.V, C: s.C, T: s.T}
+	if s.S != nil {
+		c.S = append([]string{}, s.S...)
+	}
+	if s.Z != nil {
+		c.Z = append([]ScoredMember{}, s.Z...)
+	}
+	if s.L != nil {
+		c.L = make([]storeValue, len(s.L))
+		for i, v := range s.L {
+			c.L[i] = cloneValue(v)
+		}
+	}
+	if s.M != nil {
+		c.M = make(map[string]storeValue, len(s.M))
+		for k, v := range s.M {
+			c.M[k] = cloneValue(v)
+		}
+	}
+	return c
+}
+
+// removeAt deletes the value at a path: a map key is deleted, a list element is removed from its list, and a string
+// value is cleared.
+func removeAt(s storeValue, pos []commandValue) (storeValue, error) {
+	if len(pos) == 0 {
+		return storeValue{}, nil
+	}
+	p := pos[0]
+	switch p.vt {
+	case valueString:
+		s.V = ""
+		s.T = ""
+		return s, nil
+	case valueList:
+		i := p.lc.index
+		if p.lc.key != nil {
+			var e error
+			if i, e = p.lc.key.find(s.L); e != nil {
+				return s, e
+			}
+		}
+		if i < 0 || i >= len(s.L) {
+			return s, errors.New(fmt.Sprintf("index request out of range: %d vs %d", i, len(s.L)))
+		}
+		if len(pos) == 1 {
+			s.L = append(s.L[:i:i], s.L[i+1:]...)
+			return s, nil
+		}
+		nv, e := removeAt(s.L[i], pos[1:])
+		if e != nil {
+			return s, e
+		}
+		s.L[i] = nv
+		return s, nil
+	case valueMap:
+		nv, ok := s.M[p.key]
+		if !ok {
+			return s, errors.New("map key miss " + p.key)
+		}
+		if len(pos) == 1 {
+			delete(s.M, p.key)
+			return s, nil
+		}
+		nv, e := removeAt(nv, pos[1:])
+		if e != nil {
+			return s, e
+		}
+		s.M[p.key] = nv
+		return s, nil
+	default:
+		return s, errors.New("do not understand remove value type")
+	}
+}
+
+// handleCas sets the command's value only if the current value at the command's path, as returned by a get, equals
+// the command's expected value. Missing values compare equal to the empty string. The new value keeps the type of the
+// value it replaces, and must be valid for it; a null value has no type to keep. The type applied is returned along
+// with the new stored value, so that the write can be logged with it.
+func handleCas(previous string, c *command) (string, string, bool, error) {
+	current := ""
+	if len(previous) != 0 {
+		var e error
+		current, e = handleGet(previous, c)
+		if e != nil {
+			return "", "", false, e
+		}
+	}
+	if current != c.expected_value {
+		return previous, "", false, nil
+	}
+	if l, e := valueAt(decodeStored(previous), c.pos); e == nil && len(c.value_type) == 0 && l.T != typeNull {
+		typed := *c
+		typed.value_type = l.T
+		c = &typed
+	}
+	v, e := handleSet(previous, c)
+	if e != nil {
+		return "", "", false, e
+	}
+	return v, c.value_type, true, nil
+}
+
+// handleCap caps the list at the command's path at its newest n elements, trimming it right away. A cap of zero
+// removes the cap.
+func handleCap(previous string, c *command) (string, error) {
+	n, e := strconv.Atoi(c.set_value)
+	if e != nil || n < 0 {
+		return "", errors.New("cap should be a non negative integer, saw " + c.set_value)
+	}
+	s, e := changeMapValue(decodeStored(previous), c.pos, func(s storeValue) (storeValue, error) {
+		s.C = n
+		return s.capped(), nil
+	})
+	if e != nil {
+		return "", e
+	}
+	return encodeStored(s)
+}
+
+// handleIncr adds the command's delta to the number stored at the command's path, returning the new stored value
+// along with the new number. Missing and empty values count as zero.
+func handleIncr(previous string, c *command) (string, string, error) {
+	s := storeValue{}
+	if len(previous) != 0 {
+		e := json.NewDecoder(strings.NewReader(previous)).Decode(&s)
+		if e != nil {
+			if len(c.pos) != 0 {
+				return "", "", e
+			}
+			s = storeValue{V: previous}
+		}
+	}
+	var n string
+	s, e := changeMapValue(s, c.pos, func(l storeValue) (storeValue, error) {
+		if len(l.T) != 0 && l.T != typeInt && l.T != typeFloat {
+			return l, errors.New(fmt.Sprintf("value is not a number: %s", scalarText(l)))
+		}
+		var e error
+		n, e = addNumbers(l.V, c.set_value)
+		l.V = n
+		if l.T == typeInt || l.T == typeFloat {
+			// Typed numbers stay ints only while the sum is one.
+			l.T = typeFloat
+			if _, e := strconv.ParseInt(n, 10, 64); e == nil {
+				l.T = typeInt
+			}
+		}
+		return l, e
+	})
+	if e != nil {
+		return "", "", e
+	}
+	b, e := json.Marshal(s)
+	if e != nil {
+		return "", "", e
+	}
+	return string(b), n, nil
+}
+
+// addNumbers adds two numbers held as strings. Integers stay integers, anything else is added as a decimal. Sums
+// which overflow an int64 or are not finite are refused.
+func addNumbers(a, b string) (string, error) {
+	if len(a) == 0 {
+		a = "0"
+	}
+	x, ex := strconv.ParseInt(a, 10, 64)
+	y, ey := strconv.ParseInt(b, 10, 64)
+	if ex == nil && ey == nil {
+		sum := x + y
+		if (y > 0 && sum < x) || (y < 0 && sum > x) {
+			return "", errors.New(fmt.Sprintf("integer overflow adding %s to %s", b, a))
+		}
+		return strconv.FormatInt(sum, 10), nil
+	}
+	f, e := strconv.ParseFloat(a, 64)
+	if e != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", errors.New(fmt.Sprintf("value is not a finite number: %s", a))
+	}
+	g, e := strconv.ParseFloat(b, 64)
+	if e != nil || math.IsNaN(g) || math.IsInf(g, 0) {
+		return "", errors.New(fmt.Sprintf("delta is not a finite number: %s", b))
+	}
+	if math.IsInf(f+g, 0) {
+		return "", errors.New(fmt.Sprintf("sum of %s and %s is not finite", a, b))
+	}
+	return strconv.FormatFloat(f+g, 'f', -1, 64), nil
+}
+
 func parseCommand(r []string) (*command, error) {
 	c := &command{}
 	c.pos = make([]commandValue, 0)
@@ -177,10 +1001,36 @@ func parseCommand(r []string) (*command, error) {
 	}
 	c.top_key = r[1]
 	switch r[0] {
-	case "get":
+	case "get", "getv", "getjson":
 		return parseGet(c, r[2:])
 	case "set":
 		return parseSet(c, r[2:])
+	case "incr":
+		return parseIncr(c, r[2:])
+	case "cap":
+		return parseCap(c, r[2:])
+	case "append":
+		return parseAppend(c, r[2:])
+	case "sadd", "srem":
+		return parseMember(c, command_sadd, r[2:])
+	case "sismember":
+		return parseMember(c, command_smember, r[2:])
+	case "smembers", "scard":
+		return parseSetRead(c, r[2:])
+	case "zadd", "zincr":
+		return parseSortedSet(c, command_zadd, 2, r[2:])
+	case "zrank", "zrevrank":
+		return parseSortedSet(c, command_zread, 1, r[2:])
+	case "zrange", "zrevrange", "zrangebyscore":
+		return parseSortedSet(c, command_zread, 2, r[2:])
+	case "cas":
+		return parseCas(c, r[2:])
+	case "setjson":
+		return parseSetJson(c, command_setjson, r[2:])
+	case "merge":
+		return parseSetJson(c, command_merge, r[2:])
+	case "copy", "move", "rename":
+		return parseCopy(c, r[2:])
 	default:
 		return c, errors.New(fmt.Sprintf("unknown command: %s", r[0]))
 	}
@@ -197,14 +1047,24 @@ func parseValue(c *command, r []string) (*command, error, []string) {
 		return parseMapValue(c, r[1:])
 	case "_":
 		return parseStringValue(c, r[1:])
+	case destSeparator:
+		if c.ct == command_copy {
+			return c, nil, r
+		}
+		return c, errors.New("unexpected command " + r[0]), r[1:]
 	default:
 		return c, errors.New("unexpected command " + r[0]), r[1:]
 	}
 }
 func parseMapValue(c *command, r []string) (*command, error, []string) {
+	if len(r) == 0 {
+		return c, errors.New("map command expects a key, none given"), r
+	}
 	v := commandValue{}
-	v.key = r[0]
+	v.key = unescapeKey(r[0])
 	v.vt = valueMap
+	// Other commands keep treating * as a plain key.
+	v.wildcard = r[0] == "*" && c.ct == command_get
 	c.pos = append(c.pos, v)
 	return parseValue(c, r[1:])
 }
@@ -220,27 +1080,106 @@ func parseListValue(c *command, r []string) (*command, error, []string) {
 		return c, errors.New("list command expects index/append value, none given"), r
 	}
 
+	if r[0] == "?" {
+		if c.ct != command_get {
+			return c, errors.New("filters are only allowed in get calls"), r
+		}
+		if len(r) < 4 {
+			return c, errors.New("list filter expects a field, an operator and a value"), r
+		}
+		if !filterOps[r[2]] {
+			return c, errors.New("unknown list filter operator " + r[2]), r
+		}
+		v.lc.filter = &listFilter{field: unescapeKey(r[1]), op: r[2], value: r[3]}
+		c.pos = append(c.pos, v)
+		return parseValue(c, r[4:])
+	}
+
 	var e error
 	v.lc, e = parseListCommand(r[0])
 	if v.lc.append && c.ct == command_get {
 		return c, errors.New("no append command allowed in get calls"), r
 	}
+	if v.lc.append && (c.ct == command_smember || c.ct == command_zread) {
+		return c, errors.New("no append command allowed in set reads"), r
+	}
+	if v.lc.append && c.ct == command_cas {
+		return c, errors.New("no append command allowed in cas calls"), r
+	}
+	if v.lc.append && c.ct == command_copy {
+		return c, errors.New("no append command allowed in copy, move and rename sources"), r
+	}
+	if v.lc.all && c.ct != command_get {
+		return c, errors.New("wildcards are only allowed in get calls"), r
+	}
 	if e != nil {
 		return c, e, r
 	}
 	c.pos = append(c.pos, v)
 	return parseValue(c, r[1:])
 }
+
+// capAppendPrefix starts a list token which appends and caps the list in one go. It cannot be read as an index, so
+// signed indexes like +1 keep their meaning.
+const capAppendPrefix = "+cap="
+
 func parseListCommand(s string) (listCommand, error) {
 	if s == "+" {
 		return listCommand{append: true}, nil
 	}
+	if s == "*" {
+		return listCommand{all: true}, nil
+	}
+	if strings.HasPrefix(s, capAppendPrefix) {
+		n, e := strconv.Atoi(s[len(capAppendPrefix):])
+		if e != nil || n <= 0 {
+			return listCommand{}, errors.New("capped append should look like +cap=N with N positive, saw " + s)
+		}
+		return listCommand{append: true, cap: n}, nil
+	}
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		kv := strings.SplitN(s[1:len(s)-1], "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			return listCommand{}, errors.New("list element key should look like [field=value], saw " + s)
+		}
+		return listCommand{key: &elementKey{field: unescapeKey(kv[0]), value: kv[1]}}, nil
+	}
 	i, e := strconv.Atoi(s)
 	if e != nil {
 		return listCommand{}, e
 	}
 	return listCommand{append: false, index: i}, nil
 }
+
+// escapeKey is the prefix which makes a map key in a path literal, even when it looks like a grammar token.
+const escapeKey = `\`
+
+// reservedKeys are the map keys which need escaping to be read literally in a path.
+var reservedKeys = map[string]bool{"+": true, "->": true, "_": true, "*": true, "?": true}
+
+// EscapeKey escapes a map key for use in a command path, so that keys like * are never read as grammar tokens.
+// Keys are only escaped when needed, though escaping any key is harmless.
+func EscapeKey(k string) string {
+	if reservedKeys[k] || strings.HasPrefix(k, escapeKey) || strings.HasPrefix(k, "[") {
+		return escapeKey + k
+	}
+	return k
+}
+
+// MapPath builds the path addressing nested map keys, escaping each key.
+func MapPath(keys ...string) []string {
+	p := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		p = append(p, "->", EscapeKey(k))
+	}
+	return p
+}
+
+// unescapeKey removes the escape prefix from a map key.
+func unescapeKey(k string) string {
+	return strings.TrimPrefix(k, escapeKey)
+}
+
 func parseStringValue(c *command, r []string) (*command, error, []string) {
 	v := commandValue{}
 	v.vt = valueString
@@ -254,15 +1193,244 @@ func parseSet(c *command, r []string) (*command, error) {
 		return c, errors.New("No key or value command provided for set command")
 	}
 	c.set_value = r[len(r)-1]
+	r, e := parseSetOptions(c, r[:len(r)-1])
+	if e != nil {
+		return c, e
+	}
+	c, e, r = parseValue(c, r)
+	if e != nil {
+		return c, e
+	}
+	return c, e
+}
+
+const (
+	ifVersionOption = "if-version="
+	expireOption    = "ex="
+	// expireAtOption gives an absolute deadline in unix nanoseconds. Sets with an ex=N option are logged with it, so
+	// the write and its deadline replay from the same record.
+	expireAtOption = "exat="
+	typeOption     = "type="
+)
+
+const (
+	sortOption     = "sort="
+	sortDescOption = "sort-desc="
+	projectOption  = "project="
+)
+
+// parseGetOptions consumes the modifier tokens which may follow the top key of a get command.
+func parseGetOptions(c *command, r []string) ([]string, error) {
+	for len(r) > 0 {
+		switch {
+		case strings.HasPrefix(r[0], sortOption), strings.HasPrefix(r[0], sortDescOption):
+			if len(c.sort_field) != 0 {
+				return r, errors.New("only one sort modifier is allowed in get calls")
+			}
+			c.sort_desc = strings.HasPrefix(r[0], sortDescOption)
+			c.sort_field = unescapeKey(r[0][strings.Index(r[0], "=")+1:])
+			if len(c.sort_field) == 0 {
+				return r, errors.New("empty sort field in " + r[0])
+			}
+		case strings.HasPrefix(r[0], projectOption):
+			c.project = append(c.project, unescapeKey(r[0][len(projectOption):]))
+		default:
+			return r, nil
+		}
+		c.options++
+		r = r[1:]
+	}
+	return r, nil
+}
+
+// parseSetOptions consumes the option tokens which may follow the top key of a set command.
+func parseSetOptions(c *command, r []string) ([]string, error) {
+	for len(r) > 0 {
+		switch {
+		case strings.HasPrefix(r[0], ifVersionOption):
+			v, e := strconv.ParseInt(r[0][len(ifVersionOption):], 10, 64)
+			if e != nil {
+				return r, errors.New(fmt.Sprintf("bad version in %s: %v", r[0], e))
+			}
+			c.check_version = true
+			c.if_version = v
+		case strings.HasPrefix(r[0], expireOption):
+			d, e := parseSeconds(r[0][len(expireOption):])
+			if e != nil {
+				return r, e
+			}
+			c.set_ttl = true
+			c.expires_at = time.Now().Add(d)
+		case strings.HasPrefix(r[0], expireAtOption):
+			n, e := strconv.ParseInt(r[0][len(expireAtOption):], 10, 64)
+			if e != nil {
+				return r, errors.New(fmt.Sprintf("bad time in %s: %v", r[0], e))
+			}
+			c.set_ttl = true
+			c.expires_at = time.Unix(0, n)
+		case strings.HasPrefix(r[0], typeOption):
+			c.value_type = r[0][len(typeOption):]
+			if !valueTypes[c.value_type] {
+				return r, errors.New("unknown value type in " + r[0])
+			}
+		default:
+			return r, nil
+		}
+		c.options++
+		r = r[1:]
+	}
+	return r, nil
+}
+func parseIncr(c *command, r []string) (*command, error) {
+	c.ct = command_incr
+	if len(r) == 0 {
+		return c, errors.New("No delta provided for incr command")
+	}
+	c.set_value = r[len(r)-1]
+	c, e, r := parseValue(c, r[:len(r)-1])
+	return c, e
+}
+
+const (
+	idFieldOption     = "id-field="
+	defaultIdField    = "id"
+	valueFieldOption  = "value-field="
+	defaultValueField = "value"
+)
+
+// parseAppend reads an append command, whose path leads to the list appended to, and adds the append itself to the
+// end of the path.
+func parseAppend(c *command, r []string) (*command, error) {
+	c.ct = command_append
+	c.id_field = defaultIdField
+	c.value_field = defaultValueField
+	if len(r) == 0 {
+		return c, errors.New("No value provided for append command")
+	}
+	c.set_value = r[len(r)-1]
+	r = r[:len(r)-1]
+options:
+	for len(r) > 0 {
+		switch {
+		case strings.HasPrefix(r[0], idFieldOption):
+			c.id_field = r[0][len(idFieldOption):]
+			if len(c.id_field) == 0 {
+				return c, errors.New("empty id field in " + r[0])
+			}
+		case strings.HasPrefix(r[0], valueFieldOption):
+			c.value_field = r[0][len(valueFieldOption):]
+			if len(c.value_field) == 0 {
+				return c, errors.New("empty value field in " + r[0])
+			}
+		default:
+			break options
+		}
+		c.options++
+		r = r[1:]
+	}
+	if c.id_field == c.value_field {
+		return c, errors.New("id and value fields should differ, both are " + c.id_field)
+	}
+	c, e, r := parseValue(c, r)
+	if e != nil {
+		return c, e
+	}
+	c.pos = append(c.pos, commandValue{vt: valueList, lc: listCommand{append: true}})
+	return c, nil
+}
+
+// parseMember reads a set command whose last token is a member.
+func parseMember(c *command, ct commandType, r []string) (*command, error) {
+	c.ct = ct
+	if len(r) == 0 {
+		return c, errors.New("No member provided for set command")
+	}
+	c.set_value = r[len(r)-1]
 	c, e, r := parseValue(c, r[:len(r)-1])
+	return c, e
+}
+
+// parseSortedSet reads a sorted set command, whose path is followed by n arguments.
+func parseSortedSet(c *command, ct commandType, n int, r []string) (*command, error) {
+	c.ct = ct
+	if len(r) < n {
+		return c, errors.New(fmt.Sprintf("sorted set command expects %d arguments after the path, saw %v", n, r))
+	}
+	c.args = r[len(r)-n:]
+	c, e, r := parseValue(c, r[:len(r)-n])
+	return c, e
+}
+
+func parseSetRead(c *command, r []string) (*command, error) {
+	c.ct = command_smember
+	c, e, r := parseValue(c, r)
 	if e != nil {
 		return c, e
 	}
+	if len(r) != 0 {
+		return c, errors.New(fmt.Sprintf("Extra values received on set read: %v", r))
+	}
+	return c, e
+}
+
+func parseCap(c *command, r []string) (*command, error) {
+	c.ct = command_cap
+	if len(r) == 0 {
+		return c, errors.New("No size provided for cap command")
+	}
+	c.set_value = r[len(r)-1]
+	c, e, r := parseValue(c, r[:len(r)-1])
+	return c, e
+}
+func parseCas(c *command, r []string) (*command, error) {
+	c.ct = command_cas
+	if len(r) < 2 {
+		return c, errors.New("No expected and new value provided for cas command")
+	}
+	c.expected_value = r[len(r)-2]
+	c.set_value = r[len(r)-1]
+	c, e, r := parseValue(c, r[:len(r)-2])
 	return c, e
 }
+func parseSetJson(c *command, ct commandType, r []string) (*command, error) {
+	c.ct = ct
+	if len(r) == 0 {
+		return c, errors.New("No json document provided for setjson or merge command")
+	}
+	c.set_value = r[len(r)-1]
+	c, e, r := parseValue(c, r[:len(r)-1])
+	return c, e
+}
+
+// destSeparator ends the source path of copy, move and rename commands, and is followed by the destination.
+const destSeparator = "to"
+
+func parseCopy(c *command, r []string) (*command, error) {
+	c.ct = command_copy
+	c, e, r := parseValue(c, r)
+	if e != nil {
+		return c, e
+	}
+	if len(r) < 2 || r[0] != destSeparator {
+		return c, errors.New("copy, move and rename commands expect a destination after " + destSeparator)
+	}
+	c.dest = &command{ct: command_set, top_key: r[1], pos: make([]commandValue, 0)}
+	_, e, r = parseValue(c.dest, r[2:])
+	if e != nil {
+		return c, e
+	}
+	if len(r) != 0 {
+		return c, errors.New(fmt.Sprintf("Extra values received on destination: %v", r))
+	}
+	return c, nil
+}
 func parseGet(c *command, r []string) (*command, error) {
 	c.ct = command_get
-	c, e, r := parseValue(c, r)
+	r, e := parseGetOptions(c, r)
+	if e != nil {
+		return c, e
+	}
+	c, e, r = parseValue(c, r)
 	if e != nil {
 		return c, e
 	}
@@ -104,6 +104,29 @@ func TestGetWithSpecialCharacter(t *testing.T) {
 	})
 }
 
+func TestGetWithEscapedMapKey(t *testing.T) {
+	c, e := parseCommand([]string{"get", "key", "->", `\*`, "->", "+"})
+	assert.Nil(t, e)
+	assert.Equal(t, c, &command{
+		ct:      command_get,
+		top_key: "key",
+		pos: []commandValue{
+			commandValue{
+				vt:  valueMap,
+				key: "*",
+			},
+			commandValue{
+				vt:  valueMap,
+				key: "+",
+			},
+		},
+	})
+	c, e = parseCommand(append([]string{"set", "key"}, append(MapPath("*", `\x`, "->", "plain"), "V")...))
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"*", `\x`, "->", "plain"}, []string{c.pos[0].key, c.pos[1].key, c.pos[2].key, c.pos[3].key})
+	assert.False(t, c.pos[0].wildcard)
+}
+
 func TestGetList(t *testing.T) {
 	c, e := parseCommand([]string{"get", "key", "+"})
 	assert.Nil(t, e)
@@ -504,3 +527,603 @@ func TestHandleSetStringImplicit(t *testing.T) {
 	}
 	assert.Equal(t, expected, actual)
 }
+
+func TestIncrParse(t *testing.T) {
+	c, e := parseCommand([]string{"incr", "key", "->", "likes", "2"})
+	assert.Nil(t, e)
+	assert.Equal(t, c, &command{
+		ct:      command_incr,
+		top_key: "key",
+		pos: []commandValue{
+			commandValue{
+				vt:  valueMap,
+				key: "likes",
+			},
+		},
+		set_value: "2",
+	})
+	_, e = parseCommand([]string{"incr", "key"})
+	assert.NotNil(t, e)
+}
+
+func TestHandleIncr(t *testing.T) {
+	c, e := parseCommand([]string{"incr", "key", "->", "likes", "2"})
+	assert.Nil(t, e)
+	v, n, e := handleIncr("", c)
+	assert.Nil(t, e)
+	assert.Equal(t, "2", n)
+	v, n, e = handleIncr(v, c)
+	assert.Nil(t, e)
+	assert.Equal(t, "4", n)
+	c, e = parseCommand([]string{"incr", "key", "->", "likes", "-0.5"})
+	assert.Nil(t, e)
+	v, n, e = handleIncr(v, c)
+	assert.Nil(t, e)
+	assert.Equal(t, "3.5", n)
+	cGet, e := parseCommand([]string{"get", "key", "->", "likes"})
+	assert.Nil(t, e)
+	g, e := handleGet(v, cGet)
+	assert.Nil(t, e)
+	assert.Equal(t, "3.5", g)
+}
+
+func TestHandleIncrNotANumber(t *testing.T) {
+	c, e := parseCommand([]string{"set", "key", "abc"})
+	assert.Nil(t, e)
+	v, e := handleSet("", c)
+	assert.Nil(t, e)
+	c, e = parseCommand([]string{"incr", "key", "1"})
+	assert.Nil(t, e)
+	_, _, e = handleIncr(v, c)
+	assert.NotNil(t, e)
+	c, e = parseCommand([]string{"incr", "key", "one"})
+	assert.Nil(t, e)
+	_, _, e = handleIncr("", c)
+	assert.NotNil(t, e)
+}
+
+func TestAddNumbersRange(t *testing.T) {
+	_, e := addNumbers("9223372036854775807", "1")
+	assert.NotNil(t, e)
+	_, e = addNumbers("-9223372036854775808", "-1")
+	assert.NotNil(t, e)
+	n, e := addNumbers("9223372036854775806", "1")
+	assert.Nil(t, e)
+	assert.Equal(t, "9223372036854775807", n)
+	for _, d := range []string{"NaN", "Inf", "-Inf"} {
+		_, e = addNumbers("1", d)
+		assert.NotNil(t, e)
+		_, e = addNumbers(d, "1")
+		assert.NotNil(t, e)
+	}
+	_, e = addNumbers("1.7e308", "1.7e308")
+	assert.NotNil(t, e)
+}
+
+func TestCasParse(t *testing.T) {
+	c, e := parseCommand([]string{"cas", "key", "->", "body", "old", "new"})
+	assert.Nil(t, e)
+	assert.Equal(t, c, &command{
+		ct:      command_cas,
+		top_key: "key",
+		pos: []commandValue{
+			commandValue{
+				vt:  valueMap,
+				key: "body",
+			},
+		},
+		expected_value: "old",
+		set_value:      "new",
+	})
+	_, e = parseCommand([]string{"cas", "key", "new"})
+	assert.NotNil(t, e)
+	_, e = parseCommand([]string{"cas", "key", "+", "+", "old", "new"})
+	assert.NotNil(t, e)
+}
+
+func TestHandleCas(t *testing.T) {
+	c, e := parseCommand([]string{"cas", "key", "->", "body", "", "first"})
+	assert.Nil(t, e)
+	v, _, ok, e := handleCas("", c)
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	c, e = parseCommand([]string{"cas", "key", "->", "body", "stale", "second"})
+	assert.Nil(t, e)
+	w, _, ok, e := handleCas(v, c)
+	assert.Nil(t, e)
+	assert.False(t, ok)
+	assert.Equal(t, v, w)
+	c, e = parseCommand([]string{"cas", "key", "->", "body", "first", "second"})
+	assert.Nil(t, e)
+	v, _, ok, e = handleCas(v, c)
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	cGet, e := parseCommand([]string{"get", "key", "->", "body"})
+	assert.Nil(t, e)
+	g, e := handleGet(v, cGet)
+	assert.Nil(t, e)
+	assert.Equal(t, "second", g)
+}
+
+func TestHandleCasTyped(t *testing.T) {
+	c, e := parseCommand([]string{"set", "key", "type=int", "->", "n", "1"})
+	assert.Nil(t, e)
+	v, e := handleSet("", c)
+	assert.Nil(t, e)
+	c, e = parseCommand([]string{"cas", "key", "->", "n", "1", "two"})
+	assert.Nil(t, e)
+	_, _, _, e = handleCas(v, c)
+	assert.NotNil(t, e)
+	c, e = parseCommand([]string{"cas", "key", "->", "n", "1", "2"})
+	assert.Nil(t, e)
+	v, vt, ok, e := handleCas(v, c)
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	assert.Equal(t, typeInt, vt)
+	assert.Equal(t, storeValue{V: "2", T: typeInt}, decodeStored(v).M["n"])
+}
+
+func TestHandleCasSubtree(t *testing.T) {
+	c, e := parseCommand([]string{"set", "key", "->", "body", "text"})
+	assert.Nil(t, e)
+	v, e := handleSet("", c)
+	assert.Nil(t, e)
+	cGet, e := parseCommand([]string{"get", "key"})
+	assert.Nil(t, e)
+	expected, e := handleGet(v, cGet)
+	assert.Nil(t, e)
+	c, e = parseCommand([]string{"cas", "key", expected, "top"})
+	assert.Nil(t, e)
+	_, _, ok, e := handleCas(v, c)
+	assert.Nil(t, e)
+	assert.True(t, ok)
+}
+
+func TestSetIfVersionParse(t *testing.T) {
+	c, e := parseCommand([]string{"set", "key", "if-version=3", "->", "a", "V"})
+	assert.Nil(t, e)
+	assert.Equal(t, c, &command{
+		ct:      command_set,
+		top_key: "key",
+		pos: []commandValue{
+			commandValue{
+				vt:  valueMap,
+				key: "a",
+			},
+		},
+		set_value:     "V",
+		options:       1,
+		check_version: true,
+		if_version:    3,
+	})
+	c, e = parseCommand([]string{"set", "key", "if-version=3"})
+	assert.Nil(t, e)
+	assert.Equal(t, "if-version=3", c.set_value)
+	assert.False(t, c.check_version)
+	_, e = parseCommand([]string{"set", "key", "if-version=x", "V"})
+	assert.NotNil(t, e)
+}
+
+func TestHandleSetJson(t *testing.T) {
+	c, e := parseCommand([]string{"setjson", "key", "->", "doc", `{"a":[1,"b",true,null],"m":{"x":"y"}}`})
+	assert.Nil(t, e)
+	assert.Equal(t, command_setjson, c.ct)
+	v, e := handleSetJson(`{"V":"top","M":{"doc":{"V":"old"}}}`, c)
+	assert.Nil(t, e)
+	var actual storeValue
+	assert.Nil(t, json.NewDecoder(strings.NewReader(v)).Decode(&actual))
+	expected := storeValue{
+		V: "top",
+		M: map[string]storeValue{
+			"doc": storeValue{
+				M: map[string]storeValue{
+					"a": storeValue{
+						L: []storeValue{
+							storeValue{V: "1", T: typeInt},
+							storeValue{V: "b"},
+							storeValue{V: "true", T: typeBool},
+							storeValue{T: typeNull},
+						},
+					},
+					"m": storeValue{
+						M: map[string]storeValue{
+							"x": storeValue{V: "y"},
+						},
+					},
+				},
+			},
+		},
+	}
+	assert.Equal(t, expected, actual)
+	c, e = parseCommand([]string{"setjson", "key", `{"a":`})
+	assert.Nil(t, e)
+	_, e = handleSetJson("", c)
+	assert.NotNil(t, e)
+}
+
+func TestHandleGetJson(t *testing.T) {
+	x := storeValue{M: map[string]storeValue{
+		"comments": storeValue{L: []storeValue{
+			storeValue{M: map[string]storeValue{"author": storeValue{V: "jack"}}},
+		}},
+		"title": storeValue{V: "hello"},
+		"mixed": storeValue{V: "v", L: []storeValue{storeValue{V: "a"}}},
+	}}
+	var b bytes.Buffer
+	assert.Nil(t, json.NewEncoder(&b).Encode(x))
+	c, e := parseCommand([]string{"getjson", "key"})
+	assert.Nil(t, e)
+	v, e := handleGetJson(b.String(), c)
+	assert.Nil(t, e)
+	assert.Equal(t, `{"comments":[{"author":"jack"}],"mixed":{"+":["a"],"_":"v"},"title":"hello"}`, v)
+	c, e = parseCommand([]string{"getjson", "key", "->", "comments", "+"})
+	assert.Nil(t, e)
+	v, e = handleGetJson(b.String(), c)
+	assert.Nil(t, e)
+	assert.Equal(t, `[{"author":"jack"}]`, v)
+	c, e = parseCommand([]string{"getjson", "key", "->", "title"})
+	assert.Nil(t, e)
+	v, e = handleGetJson(b.String(), c)
+	assert.Nil(t, e)
+	assert.Equal(t, `"hello"`, v)
+}
+
+func TestGetWildcardParse(t *testing.T) {
+	c, e := parseCommand([]string{"get", "key", "+", "*", "->", "*"})
+	assert.Nil(t, e)
+	assert.Equal(t, c, &command{
+		ct:      command_get,
+		top_key: "key",
+		pos: []commandValue{
+			commandValue{
+				vt: valueList,
+				lc: listCommand{all: true},
+			},
+			commandValue{
+				vt:       valueMap,
+				key:      "*",
+				wildcard: true,
+			},
+		},
+	})
+	_, e = parseCommand([]string{"set", "key", "+", "*", "V"})
+	assert.NotNil(t, e)
+	c, e = parseCommand([]string{"set", "key", "->", "*", "V"})
+	assert.Nil(t, e)
+	assert.False(t, c.pos[0].wildcard)
+	_, e = parseCommand([]string{"get", "key", "->"})
+	assert.NotNil(t, e)
+}
+
+func TestHandleGetWildcard(t *testing.T) {
+	x := storeValue{L: []storeValue{
+		storeValue{M: map[string]storeValue{"author": storeValue{V: "jack"}, "body": storeValue{V: "hi"}}},
+		storeValue{M: map[string]storeValue{"body": storeValue{V: "anonymous"}}},
+		storeValue{M: map[string]storeValue{"author": storeValue{V: "tom"}, "body": storeValue{V: "yo"}}},
+	}}
+	var b bytes.Buffer
+	assert.Nil(t, json.NewEncoder(&b).Encode(x))
+	c, e := parseCommand([]string{"get", "thread", "+", "*", "->", "author"})
+	assert.Nil(t, e)
+	v, e := handleGet(b.String(), c)
+	assert.Nil(t, e)
+	assert.Equal(t, `["jack","tom"]`, v)
+	c, e = parseCommand([]string{"get", "thread", "+", "0", "->", "*"})
+	assert.Nil(t, e)
+	v, e = handleGet(b.String(), c)
+	assert.Nil(t, e)
+	assert.Equal(t, `["jack","hi"]`, v)
+	c, e = parseCommand([]string{"getjson", "thread", "+", "*"})
+	assert.Nil(t, e)
+	v, e = handleGetJson(b.String(), c)
+	assert.Nil(t, e)
+	assert.Equal(t, `[{"author":"jack","body":"hi"},{"body":"anonymous"},{"author":"tom","body":"yo"}]`, v)
+	c, e = parseCommand([]string{"get", "thread", "+", "*", "->", "missing"})
+	assert.Nil(t, e)
+	v, e = handleGet(b.String(), c)
+	assert.Nil(t, e)
+	assert.Equal(t, `[]`, v)
+}
+
+func TestGetFilterParse(t *testing.T) {
+	c, e := parseCommand([]string{"get", "thread", "+", "?", "approved", "=", "true", "->", "author"})
+	assert.Nil(t, e)
+	assert.Equal(t, c, &command{
+		ct:      command_get,
+		top_key: "thread",
+		pos: []commandValue{
+			commandValue{
+				vt: valueList,
+				lc: listCommand{filter: &listFilter{field: "approved", op: "=", value: "true"}},
+			},
+			commandValue{
+				vt:  valueMap,
+				key: "author",
+			},
+		},
+	})
+	_, e = parseCommand([]string{"get", "thread", "+", "?", "approved", "="})
+	assert.NotNil(t, e)
+	_, e = parseCommand([]string{"get", "thread", "+", "?", "approved", "~", "x"})
+	assert.NotNil(t, e)
+	_, e = parseCommand([]string{"set", "thread", "+", "?", "approved", "=", "true", "x"})
+	assert.NotNil(t, e)
+}
+
+func TestHandleGetFilter(t *testing.T) {
+	x := storeValue{L: []storeValue{
+		storeValue{M: map[string]storeValue{"author": storeValue{V: "jack"}, "ts": storeValue{V: "9"}, "approved": storeValue{V: "true"}}},
+		storeValue{M: map[string]storeValue{"author": storeValue{V: "anon"}, "ts": storeValue{V: "10"}}},
+		storeValue{M: map[string]storeValue{"author": storeValue{V: "tom"}, "ts": storeValue{V: "11"}, "approved": storeValue{V: "true"}}},
+	}}
+	var b bytes.Buffer
+	assert.Nil(t, json.NewEncoder(&b).Encode(x))
+	c, e := parseCommand([]string{"get", "thread", "+", "?", "approved", "=", "true", "->", "author"})
+	assert.Nil(t, e)
+	v, e := handleGet(b.String(), c)
+	assert.Nil(t, e)
+	assert.Equal(t, `[{"index":0,"value":"jack"},{"index":2,"value":"tom"}]`, v)
+	c, e = parseCommand([]string{"get", "thread", "+", "?", "ts", ">", "9", "->", "author"})
+	assert.Nil(t, e)
+	v, e = handleGet(b.String(), c)
+	assert.Nil(t, e)
+	assert.Equal(t, `[{"index":1,"value":"anon"},{"index":2,"value":"tom"}]`, v)
+	c, e = parseCommand([]string{"get", "thread", "+", "?", "author", "<", "k", "->", "author"})
+	assert.Nil(t, e)
+	v, e = handleGet(b.String(), c)
+	assert.Nil(t, e)
+	assert.Equal(t, `[{"index":0,"value":"jack"},{"index":1,"value":"anon"}]`, v)
+	c, e = parseCommand([]string{"getjson", "thread", "+", "?", "approved", "!=", "true"})
+	assert.Nil(t, e)
+	v, e = handleGetJson(b.String(), c)
+	assert.Nil(t, e)
+	assert.Equal(t, `[]`, v)
+}
+
+func TestSetListElementKeyParse(t *testing.T) {
+	c, e := parseCommand([]string{"set", "thread", "+", "[id=abc123]", "->", "body", "new text"})
+	assert.Nil(t, e)
+	assert.Equal(t, c, &command{
+		ct:      command_set,
+		top_key: "thread",
+		pos: []commandValue{
+			commandValue{
+				vt: valueList,
+				lc: listCommand{key: &elementKey{field: "id", value: "abc123"}},
+			},
+			commandValue{
+				vt:  valueMap,
+				key: "body",
+			},
+		},
+		set_value: "new text",
+	})
+	_, e = parseCommand([]string{"set", "thread", "+", "[id]", "x"})
+	assert.NotNil(t, e)
+	c, e = parseCommand([]string{"get", "thread", "+", `[\*=a]`})
+	assert.Nil(t, e)
+	assert.Equal(t, &elementKey{field: "*", value: "a"}, c.pos[0].lc.key)
+}
+
+func TestHandleSetListElementKey(t *testing.T) {
+	x := storeValue{L: []storeValue{
+		storeValue{M: map[string]storeValue{"id": storeValue{V: "a"}, "body": storeValue{V: "first"}}},
+		storeValue{M: map[string]storeValue{"id": storeValue{V: "b"}, "body": storeValue{V: "second"}}},
+		storeValue{M: map[string]storeValue{"id": storeValue{V: "c"}}},
+		storeValue{M: map[string]storeValue{"id": storeValue{V: "c"}}},
+	}}
+	var b bytes.Buffer
+	assert.Nil(t, json.NewEncoder(&b).Encode(x))
+	c, e := parseCommand([]string{"set", "thread", "+", "[id=b]", "->", "body", "edited"})
+	assert.Nil(t, e)
+	v, e := handleSet(b.String(), c)
+	assert.Nil(t, e)
+	cGet, e := parseCommand([]string{"get", "thread", "+", "1", "->", "body"})
+	assert.Nil(t, e)
+	g, e := handleGet(v, cGet)
+	assert.Nil(t, e)
+	assert.Equal(t, "edited", g)
+	cGet, e = parseCommand([]string{"get", "thread", "+", "[id=b]", "->", "body"})
+	assert.Nil(t, e)
+	g, e = handleGet(v, cGet)
+	assert.Nil(t, e)
+	assert.Equal(t, "edited", g)
+	c, e = parseCommand([]string{"set", "thread", "+", "[id=missing]", "->", "body", "edited"})
+	assert.Nil(t, e)
+	_, e = handleSet(b.String(), c)
+	assert.NotNil(t, e)
+	c, e = parseCommand([]string{"set", "thread", "+", "[id=c]", "->", "body", "edited"})
+	assert.Nil(t, e)
+	_, e = handleSet(b.String(), c)
+	assert.NotNil(t, e)
+}
+
+func TestSetCappedAppendParse(t *testing.T) {
+	c, e := parseCommand([]string{"set", "key", "+", "+cap=3", "v"})
+	assert.Nil(t, e)
+	assert.Equal(t, c, &command{
+		ct:      command_set,
+		top_key: "key",
+		pos: []commandValue{
+			commandValue{
+				vt: valueList,
+				lc: listCommand{append: true, cap: 3},
+			},
+		},
+		set_value: "v",
+	})
+	_, e = parseCommand([]string{"set", "key", "+", "+cap=0", "v"})
+	assert.NotNil(t, e)
+	_, e = parseCommand([]string{"set", "key", "+", "+cap=x", "v"})
+	assert.NotNil(t, e)
+	c, e = parseCommand([]string{"set", "key", "+", "+1", "v"})
+	assert.Nil(t, e)
+	assert.Equal(t, listCommand{index: 1}, c.pos[0].lc)
+}
+
+func TestHandleCap(t *testing.T) {
+	v := ""
+	for _, s := range []string{"a", "b", "c", "d"} {
+		c, e := parseCommand([]string{"set", "key", "->", "feed", "+", "+", s})
+		assert.Nil(t, e)
+		v, e = handleSet(v, c)
+		assert.Nil(t, e)
+	}
+	c, e := parseCommand([]string{"cap", "key", "->", "feed", "2"})
+	assert.Nil(t, e)
+	v, e = handleCap(v, c)
+	assert.Nil(t, e)
+	cGet, e := parseCommand([]string{"getjson", "key", "->", "feed"})
+	assert.Nil(t, e)
+	g, e := handleGetJson(v, cGet)
+	assert.Nil(t, e)
+	assert.Equal(t, `["c","d"]`, g)
+	c, e = parseCommand([]string{"set", "key", "->", "feed", "+", "+", "e"})
+	assert.Nil(t, e)
+	v, e = handleSet(v, c)
+	assert.Nil(t, e)
+	g, e = handleGetJson(v, cGet)
+	assert.Nil(t, e)
+	assert.Equal(t, `["d","e"]`, g)
+	c, e = parseCommand([]string{"set", "key", "->", "feed", "+", "+cap=1", "f"})
+	assert.Nil(t, e)
+	v, e = handleSet(v, c)
+	assert.Nil(t, e)
+	g, e = handleGetJson(v, cGet)
+	assert.Nil(t, e)
+	assert.Equal(t, `["f"]`, g)
+	c, e = parseCommand([]string{"cap", "key", "->", "feed", "-1"})
+	assert.Nil(t, e)
+	_, e = handleCap(v, c)
+	assert.NotNil(t, e)
+}
+
+func TestSetTypeParse(t *testing.T) {
+	c, e := parseCommand([]string{"set", "key", "type=int", "->", "n", "10"})
+	assert.Nil(t, e)
+	assert.Equal(t, c, &command{
+		ct:      command_set,
+		top_key: "key",
+		pos: []commandValue{
+			commandValue{
+				vt:  valueMap,
+				key: "n",
+			},
+		},
+		set_value:  "10",
+		options:    1,
+		value_type: typeInt,
+	})
+	_, e = parseCommand([]string{"set", "key", "type=date", "10"})
+	assert.NotNil(t, e)
+}
+
+func TestHandleSetTyped(t *testing.T) {
+	v := ""
+	for _, r := range [][]string{
+		{"int", "a", "10"},
+		{"float", "b", "2.50"},
+		{"bool", "c", "1"},
+		{"null", "d", ""},
+		{"string", "e", "9"},
+		{"", "f", "9"},
+	} {
+		c, e := parseCommand([]string{"set", "key", "type=" + r[0], "->", r[1], r[2]})
+		if len(r[0]) == 0 {
+			c, e = parseCommand([]string{"set", "key", "->", r[1], r[2]})
+		}
+		assert.Nil(t, e)
+		v, e = handleSet(v, c)
+		assert.Nil(t, e)
+	}
+	c, e := parseCommand([]string{"set", "key", "type=int", "->", "a", "ten"})
+	assert.Nil(t, e)
+	_, e = handleSet(v, c)
+	assert.NotNil(t, e)
+	cGet, e := parseCommand([]string{"getjson", "key"})
+	assert.Nil(t, e)
+	g, e := handleGetJson(v, cGet)
+	assert.Nil(t, e)
+	assert.Equal(t, `{"a":10,"b":2.5,"c":true,"d":null,"e":"9","f":"9"}`, g)
+	cGet, e = parseCommand([]string{"get", "key", "->", "c"})
+	assert.Nil(t, e)
+	g, e = handleGet(v, cGet)
+	assert.Nil(t, e)
+	assert.Equal(t, "true", g)
+	c, e = parseCommand([]string{"incr", "key", "->", "a", "0.5"})
+	assert.Nil(t, e)
+	v, _, e = handleIncr(v, c)
+	assert.Nil(t, e)
+	c, e = parseCommand([]string{"incr", "key", "->", "c", "1"})
+	assert.Nil(t, e)
+	_, _, e = handleIncr(v, c)
+	assert.NotNil(t, e)
+	cGet, e = parseCommand([]string{"getjson", "key", "->", "a"})
+	assert.Nil(t, e)
+	g, e = handleGetJson(v, cGet)
+	assert.Nil(t, e)
+	assert.Equal(t, `10.5`, g)
+}
+
+func TestCompareScalars(t *testing.T) {
+	assert.Equal(t, 1, compareScalars(storeValue{V: "10", T: typeInt}, storeValue{V: "9"}))
+	assert.Equal(t, 1, compareScalars(storeValue{V: "10"}, storeValue{V: "9"}))
+	assert.Equal(t, -1, compareScalars(storeValue{V: "10", T: typeString}, storeValue{V: "9"}))
+	assert.Equal(t, 0, compareScalars(storeValue{T: typeNull}, storeValue{V: "null"}))
+	assert.Equal(t, 0, compareScalars(storeValue{V: "true", T: typeBool}, storeValue{V: "true"}))
+}
+
+func TestGetModifiersParse(t *testing.T) {
+	c, e := parseCommand([]string{"get", "thread", "sort-desc=ts", "project=author", "project=ts", "->", "comments"})
+	assert.Nil(t, e)
+	assert.Equal(t, c, &command{
+		ct:      command_get,
+		top_key: "thread",
+		pos: []commandValue{
+			commandValue{
+				vt:  valueMap,
+				key: "comments",
+			},
+		},
+		options:    3,
+		sort_field: "ts",
+		sort_desc:  true,
+		project:    []string{"author", "ts"},
+	})
+	_, e = parseCommand([]string{"get", "thread", "sort=ts", "sort=author"})
+	assert.NotNil(t, e)
+	_, e = parseCommand([]string{"get", "thread", "sort="})
+	assert.NotNil(t, e)
+}
+
+func TestHandleGetSortProject(t *testing.T) {
+	c, e := parseCommand([]string{"setjson", "thread", "->", "comments", `[
+		{"author":"jack","ts":10,"body":"a","score":3},
+		{"author":"jill","ts":9,"body":"b","score":7},
+		{"author":"bob","body":"c","score":5},
+		{"author":"ann","ts":11,"body":"d","score":1}
+	]`})
+	assert.Nil(t, e)
+	v, e := handleSetJson("", c)
+	assert.Nil(t, e)
+	for _, r := range [][]string{
+		{`[{"author":"jill","ts":9},{"author":"jack","ts":10},{"author":"ann","ts":11},{"author":"bob"}]`,
+			"sort=ts", "project=author", "project=ts", "->", "comments"},
+		{`[{"author":"ann"},{"author":"jack"},{"author":"jill"},{"author":"bob"}]`,
+			"sort-desc=ts", "project=author", "->", "comments", "+", "*"},
+		{`[{"index":1,"value":{"author":"jill"}},{"index":2,"value":{"author":"bob"}}]`,
+			"sort-desc=score", "project=author", "->", "comments", "+", "?", "score", ">=", "5"},
+		{`{"body":"a"}`, "project=body", "->", "comments", "+", "0"},
+	} {
+		c, e := parseCommand(append([]string{"getjson", "thread"}, r[1:]...))
+		assert.Nil(t, e)
+		g, e := handleGetJson(v, c)
+		assert.Nil(t, e)
+		assert.Equal(t, r[0], g)
+	}
+	c, e = parseCommand([]string{"get", "thread", "sort=ts", "->", "comments", "+"})
+	assert.Nil(t, e)
+	g, e := handleGet(v, c)
+	assert.Nil(t, e)
+	assert.Contains(t, g, `"V":"jill"`)
+}
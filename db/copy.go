@@ -0,0 +1,155 @@
+package db
+
+import (
+	"errors"
+)
+
+// Copy writes the value found at a source key and path to a destination key and path, replacing whatever was there.
+// The source comes first, followed by a "to" token and the destination, as in Copy("a", "->", "x", "to", "b").
+func (db *Db) Copy(r ...string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.transfer("copy", r...)
+}
+
+// Move is like Copy, but also deletes the source. The source is deleted before the destination path is followed,
+// which matters when both are in the same list.
+func (db *Db) Move(r ...string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.transfer("move", r...)
+}
+
+// Rename is like Move, but fails rather than replace a destination which already holds a value.
+func (db *Db) Rename(r ...string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.transfer("rename", r...)
+}
+
+// transfer runs a copy, move or rename request, logging it as a single record.
+func (db *Db) transfer(name string, r ...string) error {
+	gr := []string{name}
+	gr = append(gr, r...)
+	c, e := parseCommand(gr)
+	if e != nil {
+		db.logM("error"+name, e.Error())
+		return e
+	}
+	e = db.transferCommand(name, c)
+	if e != nil {
+		db.logM("error"+name, e.Error())
+		return e
+	}
+	db.logM(name, r...)
+	return nil
+}
+
+func (db *Db) transferCommand(name string, c *command) error {
+	db.expireIfDue(c.top_key)
+	db.expireIfDue(c.dest.top_key)
+	existing, ok := db.d[c.top_key]
+	if !ok {
+		return errors.New("top-level key miss " + c.top_key)
+	}
+	src := decodeStored(existing)
+	v, e := valueAt(src, c.pos)
+	if e != nil {
+		return e
+	}
+	v = cloneValue(v)
+	if name == "rename" && db.holdsValue(c.dest) {
+		return errors.New("rename destination already exists")
+	}
+	srcGone := false
+	if name != "copy" {
+		if len(c.pos) == 0 {
+			src = storeValue{}
+			srcGone = true
+		} else if src, e = removeAt(src, c.pos); e != nil {
+			return e
+		}
+	}
+	sameKey := c.dest.top_key == c.top_key
+	dest := src
+	if !sameKey {
+		dest = decodeStored(db.d[c.dest.top_key])
+	}
+	dest, e = changeMapValue(dest, c.dest.pos, func(storeValue) (storeValue, error) {
+		return v, nil
+	})
+	if e != nil {
+		return e
+	}
+	if name != "copy" && !sameKey {
+		if srcGone {
+			db.drop(c.top_key)
+		} else {
+			s, e := encodeStored(src)
+			if e != nil {
+				return e
+			}
+			db.write(c.top_key, s)
+		}
+	}
+	s, e := encodeStored(dest)
+	if e != nil {
+		return e
+	}
+	db.write(c.dest.top_key, s)
+	return nil
+}
+
+// holdsValue reports whether a set command's path leads to a value which exists: its top key, along with every map
+// key and list element on the path. Existing values count even when they are empty.
+func (db *Db) holdsValue(c *command) bool {
+	existing, ok := db.d[c.top_key]
+	if !ok {
+		return false
+	}
+	s := decodeStored(existing)
+	for _, p := range c.pos {
+		switch p.vt {
+		case valueString:
+			return true
+		case valueList:
+			if p.lc.append {
+				return false
+			}
+			i := p.lc.index
+			if p.lc.key != nil {
+				var e error
+				if i, e = p.lc.key.find(s.L); e != nil {
+					return false
+				}
+			}
+			if i < 0 || i >= len(s.L) {
+				return false
+			}
+			s = s.L[i]
+		case valueMap:
+			if s, ok = s.M[p.key]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Copy writes the value at a source key and path to a destination key and path, separated by a "to" token.
+func (c *Client) Copy(command ...string) error {
+	_, e := c.request(append([]string{"copy"}, command...)...)
+	return e
+}
+
+// Move is like Copy, but also deletes the source.
+func (c *Client) Move(command ...string) error {
+	_, e := c.request(append([]string{"move"}, command...)...)
+	return e
+}
+
+// Rename is like Move, but fails rather than replace a destination which already holds a value.
+func (c *Client) Rename(command ...string) error {
+	_, e := c.request(append([]string{"rename"}, command...)...)
+	return e
+}
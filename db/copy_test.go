@@ -0,0 +1,132 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCopyParse(t *testing.T) {
+	c, e := parseCommand([]string{"move", "a", "+", "0", "to", "b", "+", "+"})
+	assert.Nil(t, e)
+	assert.Equal(t, c, &command{
+		ct:      command_copy,
+		top_key: "a",
+		pos: []commandValue{
+			commandValue{
+				vt: valueList,
+				lc: listCommand{index: 0},
+			},
+		},
+		dest: &command{
+			ct:      command_set,
+			top_key: "b",
+			pos: []commandValue{
+				commandValue{
+					vt: valueList,
+					lc: listCommand{append: true},
+				},
+			},
+		},
+	})
+	_, e = parseCommand([]string{"copy", "a", "->", "x"})
+	assert.NotNil(t, e)
+	_, e = parseCommand([]string{"copy", "a", "+", "+", "to", "b"})
+	assert.NotNil(t, e)
+}
+
+func TestCopyMoveRename(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.Nil(t, db.SetJSON("thread a", `[{"body":"first"},{"body":"second"}]`))
+	assert.Nil(t, db.Move("thread a", "+", "0", "to", "thread b", "+", "+"))
+	v, e := db.GetJSON("thread a")
+	assert.Nil(t, e)
+	assert.Equal(t, `[{"body":"second"}]`, v)
+	v, e = db.GetJSON("thread b")
+	assert.Nil(t, e)
+	assert.Equal(t, `[{"body":"first"}]`, v)
+	assert.Nil(t, db.Copy("thread b", "to", "thread c"))
+	assert.Nil(t, db.Copy("thread c", "+", "0", "to", "thread c", "+", "0", "->", "copy"))
+	v, e = db.GetJSON("thread c")
+	assert.Nil(t, e)
+	assert.Equal(t, `[{"body":"first","copy":{"body":"first"}}]`, v)
+	assert.NotNil(t, db.Rename("thread c", "to", "thread a"))
+	assert.Nil(t, db.Rename("thread c", "to", "thread d"))
+	_, e = db.Get("thread c")
+	assert.NotNil(t, e)
+	assert.NotNil(t, db.Move("missing", "to", "thread d"))
+	v, e = db.GetJSON("thread d", "+", "0", "->", "copy", "->", "body")
+	assert.Nil(t, e)
+	assert.Equal(t, `"first"`, v)
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	_, e = db.Get("thread c")
+	assert.NotNil(t, e)
+	v, e = db.GetJSON("thread d")
+	assert.Nil(t, e)
+	assert.Equal(t, `[{"body":"first","copy":{"body":"first"}}]`, v)
+	v, e = db.GetJSON("thread a")
+	assert.Nil(t, e)
+	assert.Equal(t, `[{"body":"second"}]`, v)
+}
+
+func TestClientCopy(t *testing.T) {
+	db, e := NewDb(DbOptionsTest())
+	defer db.Close()
+	assert.Nil(t, e)
+	c, e := NewClient(DefaultClientOptions())
+	defer c.Close()
+	assert.Nil(t, e)
+	assert.Nil(t, c.Set("a", "->", "x", "1"))
+	assert.Nil(t, c.Copy("a", "->", "x", "to", "a", "->", "y"))
+	assert.Nil(t, c.Move("a", "->", "x", "to", "b"))
+	assert.Nil(t, c.Rename("b", "to", "c"))
+	v, e := c.Get("c")
+	assert.Nil(t, e)
+	assert.Equal(t, "1", v)
+	v, e = c.Get("a", "->", "y")
+	assert.Nil(t, e)
+	assert.Equal(t, "1", v)
+	assert.NotNil(t, c.Rename("c", "to", "a", "->", "y"))
+}
+
+func TestCopyMoveTyped(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	assert.Nil(t, db.Set("a", "type=int", "->", "n", "3"))
+	assert.Nil(t, db.Copy("a", "->", "n", "to", "b", "->", "n"))
+	assert.Nil(t, db.Move("a", "->", "n", "to", "a", "->", "m"))
+	v, e := db.GetJSON("a")
+	assert.Nil(t, e)
+	assert.Equal(t, `{"m":3}`, v)
+	v, e = db.GetJSON("b")
+	assert.Nil(t, e)
+	assert.Equal(t, `{"n":3}`, v)
+}
+
+func TestHoldsValueEmpty(t *testing.T) {
+	db, e := NewDb(DbOptionsTest())
+	defer db.Close()
+	assert.Nil(t, e)
+	assert.Nil(t, db.Set("a", "->", "empty", ""))
+	assert.Nil(t, db.SetJSON("a", "->", "null", "null"))
+	_, e = db.SAdd("a", "->", "set", "m")
+	assert.Nil(t, e)
+	_, e = db.ZAdd("a", "->", "zset", "m", "1")
+	assert.Nil(t, e)
+	for _, k := range []string{"empty", "null", "set", "zset"} {
+		ok, e := db.SetNX("a", "->", k, "v")
+		assert.Nil(t, e)
+		assert.False(t, ok)
+		assert.NotNil(t, db.Rename("a", "->", "empty", "to", "a", "->", k))
+	}
+	ok, e := db.SetXX("a", "->", "missing", "v")
+	assert.Nil(t, e)
+	assert.False(t, ok)
+}
@@ -1,13 +1,16 @@
 package db
 
 import (
+	"encoding/base64"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"strconv"
 	"sync"
+	"time"
 	"encoding/json"
 	"strings"
 )
@@ -18,15 +21,29 @@ const (
 )
 
 type Db struct {
-	l      net.Listener
-	d      map[string]string
-	logger chan<- []string
+	l        net.Listener
+	mu       sync.Mutex
+	d        map[string]string
+	versions map[string]int64
+	expires  map[string]time.Time
+	logger   chan<- []string
+	quit     chan bool
+	tx       *transaction
+	indexes  map[string]*secondaryIndex
+	ids      idGenerator
+	// ordered holds the top keys of d in order.
+	ordered *keyList
 }
 
+// ErrConflict is returned when a write's precondition, like an if-version=N option, does not hold.
+var ErrConflict = errors.New("conflict")
+
 type Options struct {
 	Filename  string
 	Port      int32
 	Overwrite bool
+	// SweepInterval is how often expired keys are looked for and deleted.
+	SweepInterval time.Duration
 }
 
 type ClientOptions struct {
@@ -34,7 +51,7 @@ type ClientOptions struct {
 }
 
 func DefaultDbOptions() Options {
-	return Options{defaultFilename, defaultPort, false}
+	return Options{defaultFilename, defaultPort, false, defaultSweepInterval}
 }
 
 func DefaultClientOptions() ClientOptions {
@@ -43,11 +60,17 @@ func DefaultClientOptions() ClientOptions {
 
 func (db *Db) Close() {
 	db.l.Close()
+	close(db.quit)
 }
 
 func NewDb(o Options) (*Db, error) {
 	db := &Db{}
 	db.d = map[string]string{}
+	db.versions = map[string]int64{}
+	db.expires = map[string]time.Time{}
+	db.indexes = map[string]*secondaryIndex{}
+	db.ordered = newKeyList()
+	db.quit = make(chan bool)
 	if o.Overwrite {
 		os.Remove(o.Filename)
 	}
@@ -61,26 +84,42 @@ func NewDb(o Options) (*Db, error) {
 		}
 		r := csv.NewReader(f)
 		var records = make([][]string, 0)
+		// ends holds the byte offset at which each record ends, so that a torn last record can be cut off.
+		var ends = make([]int64, 0)
+		var torn error
 		for {
 			r.FieldsPerRecord = 0
 			rec, e := r.Read()
 			if e == io.EOF {
 				break
 			}
+			// Only the last record may fail to parse, having been cut short by a crash while it was written.
+			if torn != nil {
+				return db, torn
+			}
+			if e != nil {
+				torn = e
+				continue
+			}
 			records = append(records, rec)
+			ends = append(ends, r.InputOffset())
 		}
-		if e != nil {
-			return db, e
-		}
-		for _, record := range records {
+		good := int64(0)
+		for i, record := range records {
 			if len(record) < 1 {
 				return db, errors.New("db log file should have at least 1 element")
 			}
-			if record[0] == "set" {
-				if e = db.Set(record[1:]...); e != nil {
-					return nil, e
-				}
+			e := db.replay(record)
+			if e == errTornRecord && i == len(records)-1 {
+				break
 			}
+			if e != nil {
+				return nil, e
+			}
+			good = ends[i]
+		}
+		if e := repairLog(o.Filename, good); e != nil {
+			return db, e
 		}
 	}
 	db.l, err = net.Listen("tcp", fmt.Sprintf(":%d", o.Port))
@@ -103,6 +142,25 @@ func NewDb(o Options) (*Db, error) {
 	// We need to know when all connections are closed before closing the logger, because a connection may request
 	// to dump something to the logger.
 	wg := sync.WaitGroup{}
+	// The sweeper logs deletions too, so it counts towards the wait group.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		interval := o.SweepInterval
+		if interval <= 0 {
+			interval = defaultSweepInterval
+		}
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				db.sweep()
+			case <-db.quit:
+				return
+			}
+		}
+	}()
 	go func() {
 		defer func() {
 			wg.Wait()
@@ -114,47 +172,63 @@ func NewDb(o Options) (*Db, error) {
 			go func(c net.Conn) {
 				defer wg.Done()
 				defer c.Close()
+				// queue holds the requests of an open multi call until exec.
+				var queue [][]string
 				for {
 					reader := csv.NewReader(c)
 					writer := csv.NewWriter(c)
 					r, e := reader.Read()
 					if e != nil {
+						db.mu.Lock()
 						db.logM("error", "read_request_csv_parse", e.Error())
+						db.mu.Unlock()
 						writer.Write([]string{"error", e.Error()})
 						writer.Flush()
 						return
 					}
-					if r[0] == "get" {
-						v, e := db.Get(r[1:]...)
-						if e != nil {
-							writer.Write([]string{"error", e.Error()})
-							writer.Flush()
-							continue
+					var reply []string
+					switch r[0] {
+					case "multi":
+						if queue != nil {
+							reply = []string{"error", "multi calls can not be nested"}
+							break
 						}
-						writer.Write([]string{"ok", v})
-						writer.Flush()
-						continue
-					} else if r[0] == "set" {
-						if len(r) < 3 {
-							writer.Write([]string{"error", fmt.Sprintf("set command requires 2 arguments, saw %v", r)})
-							writer.Flush()
-							continue
+						queue = [][]string{}
+						reply = []string{"ok"}
+					case "discard":
+						if queue == nil {
+							reply = []string{"error", "discard without multi"}
+							break
+						}
+						queue = nil
+						reply = []string{"ok"}
+					case "exec":
+						if queue == nil {
+							reply = []string{"error", "exec without multi"}
+							break
+						}
+						db.mu.Lock()
+						reply = db.exec(queue)
+						db.mu.Unlock()
+						queue = nil
+					default:
+						if queue != nil {
+							queue = append(queue, r)
+							reply = []string{"queued"}
+							break
 						}
-						e := db.Set(r[1:]...)
-						if e != nil {
-							writer.Write([]string{"error", e.Error()})
+						var ok bool
+						db.mu.Lock()
+						reply, ok = db.respond(r)
+						db.mu.Unlock()
+						if !ok {
+							writer.Write(reply)
 							writer.Flush()
-							continue
+							return
 						}
-						writer.Write([]string{"ok"})
-						writer.Flush()
-						continue
-					} else {
-						db.logM("error", "bad_command", r[0])
-						writer.Write([]string{"error", "bad_command", r[0]})
-						writer.Flush()
-						return
 					}
+					writer.Write(reply)
+					writer.Flush()
 				}
 			}(c)
 		}
@@ -162,30 +236,454 @@ func NewDb(o Options) (*Db, error) {
 	return db, nil
 }
 
+// respond runs a single request and returns the reply to send back, or false if the command is unknown. The caller
+// must hold the engine lock.
+func (db *Db) respond(r []string) ([]string, bool) {
+	switch r[0] {
+	case "get":
+		v, e := db.get(r[1:]...)
+		if e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok", v}, true
+	case "getjson":
+		v, e := db.getJson(r[1:]...)
+		if e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok", v}, true
+	case "getv":
+		v, version, e := db.getWithVersion(r[1:]...)
+		if e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok", v, strconv.FormatInt(version, 10)}, true
+	case "set":
+		if len(r) < 3 {
+			return []string{"error", fmt.Sprintf("set command requires 2 arguments, saw %v", r)}, true
+		}
+		e := db.set(r[1:]...)
+		if e == ErrConflict {
+			return []string{"conflict"}, true
+		}
+		if e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok"}, true
+	case "setnx", "setxx":
+		if len(r) < 3 {
+			return []string{"error", fmt.Sprintf("%s command requires 2 arguments, saw %v", r[0], r)}, true
+		}
+		ok, e := db.setIf(r[0], r[0] == "setxx", r[1:]...)
+		if e != nil && e != ErrConflict {
+			return errorReply(e), true
+		}
+		if !ok {
+			return []string{"conflict"}, true
+		}
+		return []string{"ok"}, true
+	case "incr":
+		if len(r) < 3 {
+			return []string{"error", fmt.Sprintf("incr command requires 2 arguments, saw %v", r)}, true
+		}
+		v, e := db.incr(r[1:]...)
+		if e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok", v}, true
+	case "setjson":
+		if len(r) < 3 {
+			return []string{"error", fmt.Sprintf("setjson command requires 2 arguments, saw %v", r)}, true
+		}
+		if e := db.setJson(r[1:]...); e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok"}, true
+	case "keys":
+		if len(r) != 2 {
+			return []string{"error", fmt.Sprintf("keys command requires 1 argument, saw %v", r)}, true
+		}
+		keys, e := db.keys(r[1])
+		if e != nil {
+			return errorReply(e), true
+		}
+		return append([]string{"ok"}, keys...), true
+	case "scan":
+		if len(r) != 4 {
+			return []string{"error", fmt.Sprintf("scan command requires 3 arguments, saw %v", r)}, true
+		}
+		count, e := strconv.Atoi(r[3])
+		if e != nil {
+			return errorReply(e), true
+		}
+		keys, cursor, e := db.scan(r[1], r[2], count)
+		if e != nil {
+			return errorReply(e), true
+		}
+		return append([]string{"ok", cursor}, keys...), true
+	case "range", "revrange":
+		if len(r) != 4 {
+			return []string{"error", fmt.Sprintf("%s command requires 3 arguments, saw %v", r[0], r)}, true
+		}
+		limit, e := strconv.Atoi(r[3])
+		if e != nil {
+			return errorReply(e), true
+		}
+		keys, e := db.rangeKeys(r[1], r[2], limit, r[0] == "revrange")
+		if e != nil {
+			return errorReply(e), true
+		}
+		return append([]string{"ok"}, keys...), true
+	case "mget":
+		values, hits := db.mget(r[1:]...)
+		reply := []string{"ok"}
+		for i, v := range values {
+			if hits[i] {
+				reply = append(reply, "hit", v)
+			} else {
+				reply = append(reply, "miss", "")
+			}
+		}
+		return reply, true
+	case "mset":
+		if e := db.mset(r[1:]...); e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok"}, true
+	case "append":
+		if len(r) < 3 {
+			return []string{"error", fmt.Sprintf("append command requires 2 arguments, saw %v", r)}, true
+		}
+		id, i, e := db.append(db.ids.next(time.Now()), r[1:]...)
+		if e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok", id, strconv.Itoa(i)}, true
+	case "cap":
+		if len(r) < 3 {
+			return []string{"error", fmt.Sprintf("cap command requires 2 arguments, saw %v", r)}, true
+		}
+		if e := db.cap(r[1:]...); e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok"}, true
+	case "merge":
+		if len(r) < 3 {
+			return []string{"error", fmt.Sprintf("merge command requires 2 arguments, saw %v", r)}, true
+		}
+		if e := db.merge(r[1:]...); e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok"}, true
+	case "patch":
+		if len(r) != 3 {
+			return []string{"error", fmt.Sprintf("patch command requires 2 arguments, saw %v", r)}, true
+		}
+		if e := db.patch(r[1], r[2]); e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok"}, true
+	case "cas":
+		if len(r) < 4 {
+			return []string{"error", fmt.Sprintf("cas command requires 3 arguments, saw %v", r)}, true
+		}
+		ok, e := db.compareAndSet(r[1:]...)
+		if e != nil {
+			return errorReply(e), true
+		}
+		if !ok {
+			return []string{"conflict"}, true
+		}
+		return []string{"ok"}, true
+	case "expire":
+		if len(r) < 3 {
+			return []string{"error", fmt.Sprintf("expire command requires 2 arguments, saw %v", r)}, true
+		}
+		d, e := parseSeconds(r[2])
+		if e == nil {
+			e = db.expire(r[1], d)
+		}
+		if e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok"}, true
+	case "ttl":
+		if len(r) < 2 {
+			return []string{"error", fmt.Sprintf("ttl command requires 1 argument, saw %v", r)}, true
+		}
+		d, e := db.ttl(r[1])
+		if e != nil {
+			return errorReply(e), true
+		}
+		if d < 0 {
+			return []string{"ok", "-1"}, true
+		}
+		return []string{"ok", formatSeconds(d)}, true
+	case "persist":
+		if len(r) < 2 {
+			return []string{"error", fmt.Sprintf("persist command requires 1 argument, saw %v", r)}, true
+		}
+		if e := db.persist(r[1]); e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok"}, true
+	case "copy", "move", "rename":
+		if e := db.transfer(r[0], r[1:]...); e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok"}, true
+	case "index-create":
+		if len(r) < 4 {
+			return []string{"error", fmt.Sprintf("index-create command requires 3 arguments, saw %v", r)}, true
+		}
+		if e := db.createIndex(r[1], r[2], r[3]); e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok"}, true
+	case "index-drop":
+		if len(r) < 2 {
+			return []string{"error", fmt.Sprintf("index-drop command requires 1 argument, saw %v", r)}, true
+		}
+		if e := db.dropIndex(r[1]); e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok"}, true
+	case "index-get":
+		if len(r) < 3 {
+			return []string{"error", fmt.Sprintf("index-get command requires 2 arguments, saw %v", r)}, true
+		}
+		refs, e := db.indexGet(r[1], r[2])
+		if e != nil {
+			return errorReply(e), true
+		}
+		b, e := json.Marshal(refs)
+		if e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok", string(b)}, true
+	case "sadd", "srem":
+		if len(r) < 3 {
+			return []string{"error", fmt.Sprintf("%s command requires 2 arguments, saw %v", r[0], r)}, true
+		}
+		ok, e := db.setMember(r[0], r[1:]...)
+		if e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok", strconv.FormatBool(ok)}, true
+	case "sismember":
+		if len(r) < 3 {
+			return []string{"error", fmt.Sprintf("sismember command requires 2 arguments, saw %v", r)}, true
+		}
+		ok, e := db.sIsMember(r[1:]...)
+		if e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok", strconv.FormatBool(ok)}, true
+	case "smembers", "scard":
+		if len(r) < 2 {
+			return []string{"error", fmt.Sprintf("%s command requires 1 argument, saw %v", r[0], r)}, true
+		}
+		s, _, e := db.members(r[0], r[1:]...)
+		if e != nil {
+			return errorReply(e), true
+		}
+		if r[0] == "scard" {
+			return []string{"ok", strconv.Itoa(len(s.S))}, true
+		}
+		return append([]string{"ok"}, s.S...), true
+	case "sunion", "sinter":
+		if len(r) < 2 {
+			return []string{"error", fmt.Sprintf("%s command requires at least 1 key, saw %v", r[0], r)}, true
+		}
+		return append([]string{"ok"}, db.combine(r[1:], r[0] == "sinter")...), true
+	case "zadd", "zincr":
+		if len(r) < 4 {
+			return []string{"error", fmt.Sprintf("%s command requires 3 arguments, saw %v", r[0], r)}, true
+		}
+		score, added, e := db.zwrite(r[0], r[1:]...)
+		if e != nil {
+			return errorReply(e), true
+		}
+		if r[0] == "zincr" {
+			return []string{"ok", score}, true
+		}
+		return []string{"ok", strconv.FormatBool(added)}, true
+	case "zrank", "zrevrank":
+		if len(r) < 3 {
+			return []string{"error", fmt.Sprintf("%s command requires 2 arguments, saw %v", r[0], r)}, true
+		}
+		rank, e := db.zrank(r[0], r[1:]...)
+		if e != nil {
+			return errorReply(e), true
+		}
+		return []string{"ok", strconv.Itoa(rank)}, true
+	case "zrange", "zrevrange", "zrangebyscore":
+		if len(r) < 4 {
+			return []string{"error", fmt.Sprintf("%s command requires 3 arguments, saw %v", r[0], r)}, true
+		}
+		z, e := db.zrange(r[0], r[1:]...)
+		if e != nil {
+			return errorReply(e), true
+		}
+		return scoredReply(z), true
+	default:
+		db.logM("error", "bad_command", r[0])
+		return []string{"error", "bad_command", r[0]}, false
+	}
+}
+
+// repairLog cuts the log off where its last good record ends, and makes sure that record ends its line, so that
+// new records are never glued onto a torn one.
+func repairLog(filename string, good int64) error {
+	if e := os.Truncate(filename, good); e != nil {
+		return e
+	}
+	if good == 0 {
+		return nil
+	}
+	f, e := os.OpenFile(filename, os.O_RDWR, 0)
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+	last := make([]byte, 1)
+	if _, e := f.ReadAt(last, good-1); e != nil {
+		return e
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+	_, e = f.WriteAt([]byte("\n"), good)
+	return e
+}
+
+func errorReply(e error) []string {
+	return []string{"error", e.Error()}
+}
+
+// replay applies a record read back from the log.
+func (db *Db) replay(record []string) error {
+	switch record[0] {
+	case "set":
+		return db.set(record[1:]...)
+	case "incr":
+		_, e := db.incr(record[1:]...)
+		return e
+	case "setjson":
+		return db.setJson(record[1:]...)
+	case "merge":
+		return db.merge(record[1:]...)
+	case "cap":
+		return db.cap(record[1:]...)
+	case "mset":
+		return db.mset(record[1:]...)
+	case "sadd", "srem":
+		_, e := db.setMember(record[0], record[1:]...)
+		return e
+	case "zadd", "zincr":
+		_, _, e := db.zwrite(record[0], record[1:]...)
+		return e
+	case "append-id":
+		if len(record) < 4 {
+			return errors.New("db log append-id record requires an id, a key and a value")
+		}
+		_, _, e := db.append(record[1], record[2:]...)
+		return e
+	case "patch":
+		if len(record) != 3 {
+			return errors.New("db log patch record requires a key and a patch")
+		}
+		return db.patch(record[1], record[2])
+	case "del", "expireat", "persist":
+		return db.replayExpiry(record)
+	case "copy", "move", "rename":
+		return db.transfer(record[0], record[1:]...)
+	case "index-create":
+		if len(record) < 4 {
+			return errors.New("db log index-create record requires a name, pattern and field")
+		}
+		return db.createIndex(record[1], record[2], record[3])
+	case "index-drop":
+		if len(record) < 2 {
+			return errors.New("db log index-drop record requires a name")
+		}
+		return db.dropIndex(record[1])
+	case "exec":
+		return db.replayExec(record)
+	}
+	return nil
+}
+
 func (db *Db) Get(r ...string) (string, error) {
-	gr := []string{"get"}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.get(r...)
+}
+
+// GetWithVersion is like Get, but also returns the version of the top key, which counts the writes made to it.
+func (db *Db) GetWithVersion(r ...string) (string, int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.getWithVersion(r...)
+}
+
+func (db *Db) getWithVersion(r ...string) (string, int64, error) {
+	v, e := db.get(r...)
+	if e != nil {
+		return "", 0, e
+	}
+	return v, db.versions[r[0]], nil
+}
+
+func (db *Db) get(r ...string) (string, error) {
+	return db.getWith(handleGet, "get", r...)
+}
+
+// GetJSON is like Get, but returns plain json, with maps as objects, lists as arrays and string values as strings.
+// A value holding more than one of these is returned as an object keyed by "_" for its string value, "+" for its
+// list and "->" for its map.
+func (db *Db) GetJSON(r ...string) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.getJson(r...)
+}
+
+func (db *Db) getJson(r ...string) (string, error) {
+	return db.getWith(handleGetJson, "getjson", r...)
+}
+
+// getWith runs a get request, formatting what is found with the handler.
+func (db *Db) getWith(handle func(string, *command) (string, error), name string, r ...string) (string, error) {
+	gr := []string{name}
 	gr = append(gr, r...)
 	c, e := parseCommand(gr)
 	if e != nil {
-		db.logM("errorget", e.Error())
+		db.logM("error"+name, e.Error())
 		return "", e
 	}
+	db.expireIfDue(c.top_key)
 	existing, ok := db.d[c.top_key]
 	if !ok {
 		e = errors.New("top-level key miss " + c.top_key)
-		db.logM("errorget", e.Error())
+		db.logM("error"+name, e.Error())
 		return "", e
 	}
-	v, e := handleGet(existing, c)
+	v, e := handle(existing, c)
 	if e != nil {
-		db.logM("errorget", e.Error())
+		db.logM("error"+name, e.Error())
 		return "", e
 	}
-	db.logM("get", r...)
+	db.logM(name, r...)
 	return v, nil
 }
 
 func (db *Db) Set(r ...string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.set(r...)
+}
+
+func (db *Db) set(r ...string) error {
 	gr := []string{"set"}
 	gr = append(gr, r...)
 	c, e := parseCommand(gr)
@@ -193,22 +691,208 @@ func (db *Db) Set(r ...string) error {
 		db.logM("errorset", e.Error())
 		return e
 	}
+	db.expireIfDue(c.top_key)
+	return db.setParsed(c, r)
+}
+
+// setParsed runs a parsed set command, given the arguments it was parsed from.
+func (db *Db) setParsed(c *command, r []string) error {
+	if c.check_version && db.versions[c.top_key] != c.if_version {
+		return ErrConflict
+	}
 	v, e := handleSet(db.d[c.top_key], c)
 	if e != nil {
 		db.logM("errorget", e.Error())
 		return e
 	}
-	db.d[c.top_key] = v
-	db.logM("set", r...)
+	db.write(c.top_key, v)
+	// Options are checked and applied here, so only the write itself is logged as a set, along with the type it
+	// gives the value and its deadline. Keeping the deadline in the same record means a crash cannot leave a logged
+	// write whose expiry was lost.
+	record := r[:1:1]
+	if c.set_ttl {
+		db.expires[c.top_key] = c.expires_at
+		record = append(record, expireAtOption+strconv.FormatInt(c.expires_at.UnixNano(), 10))
+	}
+	if len(c.value_type) != 0 {
+		record = append(record, typeOption+c.value_type)
+	}
+	db.logM("set", append(record, r[1+c.options:]...)...)
+	return nil
+}
+
+// SetNX is like Set, but only writes if the key and path do not hold a value yet. It reports whether it wrote.
+func (db *Db) SetNX(r ...string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.setIf("setnx", false, r...)
+}
+
+// SetXX is like Set, but only writes if the key and path already hold a value. It reports whether it wrote.
+func (db *Db) SetXX(r ...string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.setIf("setxx", true, r...)
+}
+
+// setIf writes only if whether the key and path hold a value matches present. A write is logged as a set.
+func (db *Db) setIf(name string, present bool, r ...string) (bool, error) {
+	gr := []string{"set"}
+	gr = append(gr, r...)
+	c, e := parseCommand(gr)
+	if e != nil {
+		db.logM("error"+name, e.Error())
+		return false, e
+	}
+	db.expireIfDue(c.top_key)
+	if db.holdsValue(c) != present {
+		return false, nil
+	}
+	if e := db.setParsed(c, r); e != nil {
+		return false, e
+	}
+	return true, nil
+}
+
+// SetJSON replaces the structure at the given key and path with the trailing json document, converting objects to
+// maps and arrays to lists.
+func (db *Db) SetJSON(r ...string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.setJson(r...)
+}
+
+func (db *Db) setJson(r ...string) error {
+	gr := []string{"setjson"}
+	gr = append(gr, r...)
+	c, e := parseCommand(gr)
+	if e != nil {
+		db.logM("errorsetjson", e.Error())
+		return e
+	}
+	db.expireIfDue(c.top_key)
+	v, e := handleSetJson(db.d[c.top_key], c)
+	if e != nil {
+		db.logM("errorsetjson", e.Error())
+		return e
+	}
+	db.write(c.top_key, v)
+	db.logM("setjson", r...)
 	return nil
 }
 
+// Incr adds the trailing delta to the number stored at the given key and path, returning the new number.
+func (db *Db) Incr(r ...string) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.incr(r...)
+}
+
+func (db *Db) incr(r ...string) (string, error) {
+	gr := []string{"incr"}
+	gr = append(gr, r...)
+	c, e := parseCommand(gr)
+	if e != nil {
+		db.logM("errorincr", e.Error())
+		return "", e
+	}
+	db.expireIfDue(c.top_key)
+	v, n, e := handleIncr(db.d[c.top_key], c)
+	if e != nil {
+		db.logM("errorincr", e.Error())
+		return "", e
+	}
+	db.write(c.top_key, v)
+	db.logM("incr", r...)
+	return n, nil
+}
+
+// Cap caps the list at the given key and path at its newest n elements, given last. Appending past the cap drops
+// the oldest elements. A cap of zero removes the cap.
+func (db *Db) Cap(r ...string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.cap(r...)
+}
+
+func (db *Db) cap(r ...string) error {
+	gr := []string{"cap"}
+	gr = append(gr, r...)
+	c, e := parseCommand(gr)
+	if e != nil {
+		db.logM("errorcap", e.Error())
+		return e
+	}
+	db.expireIfDue(c.top_key)
+	v, e := handleCap(db.d[c.top_key], c)
+	if e != nil {
+		db.logM("errorcap", e.Error())
+		return e
+	}
+	db.write(c.top_key, v)
+	db.logM("cap", r...)
+	return nil
+}
+
+// CompareAndSet sets the trailing new value at the given key and path only if the current value there equals the
+// expected value preceding it. It reports whether the value was written; a successful write is logged as a set.
+func (db *Db) CompareAndSet(r ...string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.compareAndSet(r...)
+}
+
+func (db *Db) compareAndSet(r ...string) (bool, error) {
+	gr := []string{"cas"}
+	gr = append(gr, r...)
+	c, e := parseCommand(gr)
+	if e != nil {
+		db.logM("errorcas", e.Error())
+		return false, e
+	}
+	db.expireIfDue(c.top_key)
+	v, t, ok, e := handleCas(db.d[c.top_key], c)
+	if e != nil {
+		db.logM("errorcas", e.Error())
+		return false, e
+	}
+	if !ok {
+		return false, nil
+	}
+	db.write(c.top_key, v)
+	// The write is logged as a set, along with the type it kept, the way setParsed logs it.
+	sr := r[:1:1]
+	if len(t) != 0 {
+		sr = append(sr, typeOption+t)
+	}
+	sr = append(sr, r[1:len(r)-2]...)
+	db.logM("set", append(sr, r[len(r)-1])...)
+	return true, nil
+}
+
+// write stores a new value for a top key and bumps its version. Versions are not logged, but are rebuilt by the
+// replay of the writes in NewDb.
+func (db *Db) write(key, v string) {
+	db.touch(key)
+	if _, ok := db.d[key]; !ok {
+		db.ordered.insert(key)
+	}
+	db.d[key] = v
+	db.versions[key]++
+	db.reindex(key)
+}
+
+// logM logs a record, or holds it back until the running transaction ends. The caller must hold the engine lock.
 func (db *Db) logM(s string, r ...string) {
 	if db.logger == nil {
 		return
 	}
 	c := []string{s}
 	c = append(c, r...)
+	if db.tx != nil {
+		db.tx.log = append(db.tx.log, c)
+		return
+	}
 	db.logger <- c
 }
 
@@ -223,45 +907,137 @@ func NewClient(o ClientOptions) (*Client, error) {
 	return c, err
 }
 
-func (c *Client) Get(command ...string) (string, error) {
+// request sends a single csv command to the server and returns its reply, converting error replies to errors.
+func (c *Client) request(command ...string) ([]string, error) {
 	writer := csv.NewWriter(c.conn)
-	rs := []string{"get"}
-	rs = append(rs, command...)
-	e := writer.Write(rs)
+	e := writer.Write(command)
 	if e != nil {
-		return "", e
+		return nil, e
 	}
 	writer.Flush()
 	r, e := csv.NewReader(c.conn).Read()
 	if e != nil {
-		return "", e
+		return nil, e
 	}
 	if r[0] == "error" {
-		return "", errors.New(r[1])
+		return nil, errors.New(r[1])
+	}
+	return r, nil
+}
+
+func (c *Client) Get(command ...string) (string, error) {
+	r, e := c.request(append([]string{"get"}, command...)...)
+	if e != nil {
+		return "", e
 	}
 	return r[1], nil
 }
 
-func (c *Client) Set(command ...string) error {
-	writer := csv.NewWriter(c.conn)
-	rs := []string{"set"}
-	rs = append(rs, command...)
-	e := writer.Write(rs)
+// GetJSON decodes the plain json found at the key and optional path into dst.
+func (c *Client) GetJSON(key string, dst interface{}, path ...string) error {
+	r, e := c.request(append([]string{"getjson", key}, path...)...)
 	if e != nil {
 		return e
 	}
-	writer.Flush()
-	reader := csv.NewReader(c.conn)
-	r, e := reader.Read()
+	return json.Unmarshal([]byte(r[1]), dst)
+}
+
+// GetWithVersion is like Get, but also returns the version of the top key.
+func (c *Client) GetWithVersion(command ...string) (string, int64, error) {
+	r, e := c.request(append([]string{"getv"}, command...)...)
+	if e != nil {
+		return "", 0, e
+	}
+	if len(r) < 3 {
+		return "", 0, errors.New("getv response missing version")
+	}
+	version, e := strconv.ParseInt(r[2], 10, 64)
+	if e != nil {
+		return "", 0, e
+	}
+	return r[1], version, nil
+}
+
+// Set writes the trailing value, returning ErrConflict if an if-version=N option does not hold.
+func (c *Client) Set(command ...string) error {
+	r, e := c.request(append([]string{"set"}, command...)...)
 	if e != nil {
 		return e
 	}
-	if r[0] == "error" {
-		return errors.New(r[1])
+	if r[0] == "conflict" {
+		return ErrConflict
 	}
 	return nil
 }
 
+// SetNX writes the trailing value only if the key and path do not hold a value yet, reporting whether it wrote.
+func (c *Client) SetNX(command ...string) (bool, error) {
+	return c.setIf("setnx", command)
+}
+
+// SetXX writes the trailing value only if the key and path already hold a value, reporting whether it wrote.
+func (c *Client) SetXX(command ...string) (bool, error) {
+	return c.setIf("setxx", command)
+}
+
+func (c *Client) setIf(name string, command []string) (bool, error) {
+	r, e := c.request(append([]string{name}, command...)...)
+	if e != nil {
+		return false, e
+	}
+	return r[0] == "ok", nil
+}
+
+// SetBytes stores binary data at the key and optional path, as a value typed as bytes.
+func (c *Client) SetBytes(key string, b []byte, path ...string) error {
+	command := append([]string{key, typeOption + typeBytes}, path...)
+	return c.Set(append(command, base64.StdEncoding.EncodeToString(b))...)
+}
+
+// GetBytes returns the binary data stored at the key and optional path by SetBytes.
+func (c *Client) GetBytes(key string, path ...string) ([]byte, error) {
+	v, e := c.Get(append(append([]string{key}, path...), "_")...)
+	if e != nil {
+		return nil, e
+	}
+	return base64.StdEncoding.DecodeString(v)
+}
+
+// SetJSON stores any value which encoding/json can marshal under the key, as maps, lists and typed string values.
+func (c *Client) SetJSON(key string, v interface{}) error {
+	b, e := json.Marshal(v)
+	if e != nil {
+		return e
+	}
+	_, e = c.request("setjson", key, string(b))
+	return e
+}
+
+// Incr atomically adds the trailing delta to the number at the given key and path, returning the new number.
+func (c *Client) Incr(command ...string) (string, error) {
+	r, e := c.request(append([]string{"incr"}, command...)...)
+	if e != nil {
+		return "", e
+	}
+	return r[1], nil
+}
+
+// Cap caps the list at the given key and path at its newest n elements, given last.
+func (c *Client) Cap(command ...string) error {
+	_, e := c.request(append([]string{"cap"}, command...)...)
+	return e
+}
+
+// CompareAndSet sets the trailing new value only if the current value equals the expected value preceding it,
+// reporting whether the value was written.
+func (c *Client) CompareAndSet(command ...string) (bool, error) {
+	r, e := c.request(append([]string{"cas"}, command...)...)
+	if e != nil {
+		return false, e
+	}
+	return r[0] == "ok", nil
+}
+
 func (c *Client) GetList(key string) ([]string, error) {
 	r, e := c.Get(key)
 	if e != nil{
@@ -281,11 +1057,6 @@ func (c *Client) GetList(key string) ([]string, error) {
 	return v, nil
 }
 
-func (c *Client) Append(key, value string) error {
-	return c.Set(key, "+","+",value)
-}
-
-
 func (client *Client) Close() {
 	client.conn.Close()
 }
@@ -39,6 +39,207 @@ func TestDb(t *testing.T) {
 	assert.Equal(t, "c", v)
 }
 
+func TestDbIncr(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	v, e := db.Incr("views", "1")
+	assert.Nil(t, e)
+	assert.Equal(t, "1", v)
+	v, e = db.Incr("views", "10")
+	assert.Nil(t, e)
+	assert.Equal(t, "11", v)
+	_, e = db.Incr("views", "x")
+	assert.NotNil(t, e)
+	v, e = db.Get("views")
+	assert.Nil(t, e)
+	assert.Equal(t, "11", v)
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	v, e = db.Get("views")
+	assert.Nil(t, e)
+	assert.Equal(t, "11", v)
+}
+
+func TestDbCompareAndSet(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.Nil(t, db.Set("doc", "->", "body", "v1"))
+	ok, e := db.CompareAndSet("doc", "->", "body", "v0", "v2")
+	assert.Nil(t, e)
+	assert.False(t, ok)
+	ok, e = db.CompareAndSet("doc", "->", "body", "v1", "v2")
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	v, e := db.Get("doc", "->", "body")
+	assert.Nil(t, e)
+	assert.Equal(t, "v2", v)
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	assert.Nil(t, e)
+	v, e = db.Get("doc", "->", "body")
+	assert.Nil(t, e)
+	assert.Equal(t, "v2", v)
+	assert.Nil(t, db.Set("n", "type=int", "->", "c", "5"))
+	ok, e = db.CompareAndSet("n", "->", "c", "5", "6")
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	v, e = db.GetJSON("n")
+	assert.Nil(t, e)
+	assert.Equal(t, `{"c":6}`, v)
+	db.Close()
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	v, e = db.GetJSON("n")
+	assert.Nil(t, e)
+	assert.Equal(t, `{"c":6}`, v)
+}
+
+func TestDbSetNXXX(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	ok, e := db.SetNX("email:jack", "->", "name", "jack")
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	ok, e = db.SetNX("email:jack", "->", "name", "jill")
+	assert.Nil(t, e)
+	assert.False(t, ok)
+	ok, e = db.SetNX("email:jack", "->", "age", "30")
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	ok, e = db.SetXX("email:jill", "->", "name", "jill")
+	assert.Nil(t, e)
+	assert.False(t, ok)
+	ok, e = db.SetXX("email:jack", "->", "age", "31")
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	_, e = db.Get("email:jill")
+	assert.NotNil(t, e)
+	v, e := db.Get("email:jack", "->", "name")
+	assert.Nil(t, e)
+	assert.Equal(t, "jack", v)
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	v, e = db.Get("email:jack", "->", "age")
+	assert.Nil(t, e)
+	assert.Equal(t, "31", v)
+}
+
+func TestDbCap(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.Nil(t, db.Cap("feed", "3"))
+	for _, s := range []string{"a", "b", "c", "d", "e"} {
+		assert.Nil(t, db.Set("feed", "+", "+", s))
+	}
+	v, e := db.GetJSON("feed")
+	assert.Nil(t, e)
+	assert.Equal(t, `["c","d","e"]`, v)
+	assert.Nil(t, db.Set("feed", "+", "+cap=2", "f"))
+	assert.NotNil(t, db.Cap("feed", "x"))
+	v, e = db.GetJSON("feed")
+	assert.Nil(t, e)
+	assert.Equal(t, `["e","f"]`, v)
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	assert.Nil(t, db.Set("feed", "+", "+", "g"))
+	v, e = db.GetJSON("feed")
+	assert.Nil(t, e)
+	assert.Equal(t, `["f","g"]`, v)
+}
+
+func TestDbVersions(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.Nil(t, db.Set("doc", "if-version=0", "a"))
+	assert.Equal(t, ErrConflict, db.Set("doc", "if-version=0", "b"))
+	_, e = db.Incr("doc", "->", "n", "1")
+	assert.Nil(t, e)
+	assert.Nil(t, db.Set("doc", "if-version=2", "c"))
+	v, version, e := db.GetWithVersion("doc", "_")
+	assert.Nil(t, e)
+	assert.Equal(t, "c", v)
+	assert.Equal(t, int64(3), version)
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	v, version, e = db.GetWithVersion("doc", "_")
+	assert.Nil(t, e)
+	assert.Equal(t, "c", v)
+	assert.Equal(t, int64(3), version)
+	_, _, e = db.GetWithVersion("missing")
+	assert.NotNil(t, e)
+}
+
+func TestDbSetJSON(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.Nil(t, db.SetJSON("thread", `[{"author":"jack","body":"hi"}]`))
+	v, e := db.Get("thread", "+", "0", "->", "author")
+	assert.Nil(t, e)
+	assert.Equal(t, "jack", v)
+	v, e = db.GetJSON("thread", "sort=author", "project=author", "+")
+	assert.Nil(t, e)
+	assert.Equal(t, `[{"author":"jack"}]`, v)
+	assert.NotNil(t, db.SetJSON("thread", `nope`))
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	v, e = db.Get("thread", "+", "0", "->", "body")
+	assert.Nil(t, e)
+	assert.Equal(t, "hi", v)
+}
+
+func TestDbTypedValues(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.Nil(t, db.Set("post", "type=int", "ex=60", "->", "likes", "10"))
+	assert.Nil(t, db.Set("post", "type=bool", "->", "pinned", "false"))
+	assert.Nil(t, db.SetJSON("post", "->", "meta", `{"score":2.5,"tag":null}`))
+	assert.NotNil(t, db.Set("post", "type=float", "->", "likes", "lots"))
+	assert.Nil(t, db.Set("blob", "type=bytes", "AAEK/w=="))
+	assert.NotNil(t, db.Set("blob", "type=bytes", "not base64"))
+	_, e = db.Incr("post", "->", "likes", "1")
+	assert.Nil(t, e)
+	v, e := db.GetJSON("post")
+	assert.Nil(t, e)
+	assert.Equal(t, `{"likes":11,"meta":{"score":2.5,"tag":null},"pinned":false}`, v)
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	v, e = db.GetJSON("post")
+	assert.Nil(t, e)
+	assert.Equal(t, `{"likes":11,"meta":{"score":2.5,"tag":null},"pinned":false}`, v)
+	v, e = db.GetJSON("blob")
+	assert.Nil(t, e)
+	assert.Equal(t, `"AAEK/w=="`, v)
+	_, e = db.Incr("blob", "1")
+	assert.NotNil(t, e)
+}
+
 func TestClient(t *testing.T) {
 	db, e := NewDb(DbOptionsTest())
 	defer db.Close()
@@ -59,9 +260,20 @@ func TestClient(t *testing.T) {
 	assert.Nil(t,e)
 	assert.Equal(t, "value", v)
 
-	assert.Nil(t, c.Append("ap", "apa"))
-	assert.Nil(t, c.Append("ap", "apb"))
-	l, e := c.GetList("ap")
+	ida, e := c.Append("ap", "apa")
+	assert.Nil(t, e)
+	idb, e := c.Append("ap", "apb")
+	assert.Nil(t, e)
+	assert.True(t, ida < idb)
+	v, e = c.Get("ap", "+", "1", "->", "id")
+	assert.Nil(t, e)
+	assert.Equal(t, idb, v)
+	v, e = c.Get("ap", "+", "0", "->", "value")
+	assert.Nil(t, e)
+	assert.Equal(t, "apa", v)
+	assert.Nil(t, c.Set("pl", "+", "+", "apa"))
+	assert.Nil(t, c.Set("pl", "+", "+", "apb"))
+	l, e := c.GetList("pl")
 	assert.Nil(t,e)
 	assert.Equal(t,[]string{"apa", "apb"}, l)
 
@@ -72,6 +284,89 @@ func TestClient(t *testing.T) {
 	l, e = c.GetList("mapkey")
 	assert.Nil(t,e)
 	assert.Empty(t,l)
+
+	v, e = c.Incr("counter", "->", "likes", "1")
+	assert.Nil(t, e)
+	assert.Equal(t, "1", v)
+	v, e = c.Incr("counter", "->", "likes", "1")
+	assert.Nil(t, e)
+	assert.Equal(t, "2", v)
+	_, e = c.Incr("a", "1")
+	assert.NotNil(t, e)
+
+	ok, e := c.CompareAndSet("a", "x", "y")
+	assert.Nil(t, e)
+	assert.False(t, ok)
+	ok, e = c.CompareAndSet("a", "b", "y")
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	v, e = c.Get("a")
+	assert.Nil(t, e)
+	assert.Equal(t, "y", v)
+
+	v, version, e := c.GetWithVersion("a")
+	assert.Nil(t, e)
+	assert.Equal(t, "y", v)
+	assert.Equal(t, int64(2), version)
+	assert.Equal(t, ErrConflict, c.Set("a", "if-version=1", "z"))
+	assert.Nil(t, c.Set("a", "if-version=2", "z"))
+
+	assert.Nil(t, c.Cap("recent", "1"))
+	assert.Nil(t, c.Set("recent", "+", "+", "x"))
+	assert.Nil(t, c.Set("recent", "+", "+", "y"))
+	v, e = c.Get("recent", "+", "0")
+	assert.Nil(t, e)
+	assert.Equal(t, "y", v)
+	assert.NotNil(t, c.Cap("recent", "-1"))
+
+	blob := make([]byte, 256)
+	for i := range blob {
+		blob[i] = byte(i)
+	}
+	assert.Nil(t, c.SetBytes("image", blob))
+	assert.Nil(t, c.SetBytes("image", []byte("\n,\"\r"), "->", "thumb"))
+	b, e := c.GetBytes("image")
+	assert.Nil(t, e)
+	assert.Equal(t, blob, b)
+	b, e = c.GetBytes("image", "->", "thumb")
+	assert.Nil(t, e)
+	assert.Equal(t, []byte("\n,\"\r"), b)
+	_, e = c.GetBytes("missing")
+	assert.NotNil(t, e)
+
+	ok, e = c.SetNX("slot:jack", "profile")
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	ok, e = c.SetNX("slot:jack", "other")
+	assert.Nil(t, e)
+	assert.False(t, ok)
+	ok, e = c.SetXX("slot:jill", "profile")
+	assert.Nil(t, e)
+	assert.False(t, ok)
+	ok, e = c.SetXX("slot:jack", "updated")
+	assert.Nil(t, e)
+	assert.True(t, ok)
+
+	assert.Nil(t, c.SetJSON("doc", map[string]interface{}{"title": "hello", "tags": []string{"x", "y"}}))
+	v, e = c.Get("doc", "->", "tags", "+", "1")
+	assert.Nil(t, e)
+	assert.Equal(t, "y", v)
+	var doc struct {
+		Title string
+		Tags  []string
+	}
+	assert.Nil(t, c.GetJSON("doc", &doc))
+	assert.Equal(t, "hello", doc.Title)
+	assert.Equal(t, []string{"x", "y"}, doc.Tags)
+	var tags []string
+	assert.Nil(t, c.GetJSON("doc", &tags, "->", "tags"))
+	assert.Equal(t, []string{"x", "y"}, tags)
+
+	assert.Nil(t, c.Set(append(append([]string{"special"}, MapPath("*", "->")...), "starred")...))
+	assert.Nil(t, c.Set(append(append([]string{"special"}, MapPath("other")...), "plain")...))
+	v, e = c.Get(append([]string{"special"}, MapPath("*", "->")...)...)
+	assert.Nil(t, e)
+	assert.Equal(t, "starred", v)
 }
 
 func TestTcp(t *testing.T) {
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+const defaultSweepInterval = time.Second
+
+// Expire makes a top key expire after the given duration. The deadline is logged as an absolute time, so a
+// restarted database keeps it.
+func (db *Db) Expire(key string, d time.Duration) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.expire(key, d)
+}
+
+func (db *Db) expire(key string, d time.Duration) error {
+	db.expireIfDue(key)
+	if _, ok := db.d[key]; !ok {
+		e := errors.New("top-level key miss " + key)
+		db.logM("errorexpire", e.Error())
+		return e
+	}
+	db.expireAt(key, time.Now().Add(d))
+	return nil
+}
+
+// TTL returns the time left before a top key expires, or a negative duration if it does not expire.
+func (db *Db) TTL(key string) (time.Duration, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.ttl(key)
+}
+
+func (db *Db) ttl(key string) (time.Duration, error) {
+	db.expireIfDue(key)
+	if _, ok := db.d[key]; !ok {
+		e := errors.New("top-level key miss " + key)
+		db.logM("errorttl", e.Error())
+		return 0, e
+	}
+	t, ok := db.expires[key]
+	if !ok {
+		return -1, nil
+	}
+	return t.Sub(time.Now()), nil
+}
+
+// Persist removes the expiry of a top key.
+func (db *Db) Persist(key string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.persist(key)
+}
+
+func (db *Db) persist(key string) error {
+	db.expireIfDue(key)
+	if _, ok := db.d[key]; !ok {
+		e := errors.New("top-level key miss " + key)
+		db.logM("errorpersist", e.Error())
+		return e
+	}
+	db.touch(key)
+	delete(db.expires, key)
+	db.logM("persist", key)
+	return nil
+}
+
+func (db *Db) expireAt(key string, t time.Time) {
+	db.touch(key)
+	db.expires[key] = t
+	db.logM("expireat", key, strconv.FormatInt(t.UnixNano(), 10))
+}
+
+// expireIfDue deletes a top key whose deadline has passed, logging the deletion.
+// While the log is replayed there is no logger, and deletions only come from the logged del records, so that replay
+// always gives the same state no matter when it runs.
+func (db *Db) expireIfDue(key string) {
+	if db.logger == nil {
+		return
+	}
+	t, ok := db.expires[key]
+	if !ok || time.Now().Before(t) {
+		return
+	}
+	db.remove(key)
+}
+
+// remove deletes a top key along with its expiry, logging the deletion.
+func (db *Db) remove(key string) {
+	db.drop(key)
+	db.logM("del", key)
+}
+
+// drop deletes a top key along with its expiry, and counts as a write to its version.
+func (db *Db) drop(key string) {
+	db.touch(key)
+	delete(db.d, key)
+	db.ordered.remove(key)
+	delete(db.expires, key)
+	db.versions[key]++
+	db.reindex(key)
+}
+
+// sweep expires every top key whose deadline has passed, so that keys nobody reads still get cleaned up.
+func (db *Db) sweep() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for key := range db.expires {
+		db.expireIfDue(key)
+	}
+}
+
+// replayExpiry applies the logged del, expireat and persist records.
+func (db *Db) replayExpiry(record []string) error {
+	if len(record) < 2 {
+		return errors.New("db log " + record[0] + " record requires a key")
+	}
+	switch record[0] {
+	case "del":
+		db.remove(record[1])
+	case "persist":
+		delete(db.expires, record[1])
+	case "expireat":
+		if len(record) < 3 {
+			return errors.New("db log expireat record requires a time")
+		}
+		n, e := strconv.ParseInt(record[2], 10, 64)
+		if e != nil {
+			return e
+		}
+		db.expires[record[1]] = time.Unix(0, n)
+	}
+	return nil
+}
+
+// parseSeconds reads a possibly fractional number of seconds.
+func parseSeconds(s string) (time.Duration, error) {
+	f, e := strconv.ParseFloat(s, 64)
+	if e != nil {
+		return 0, errors.New("bad number of seconds: " + s)
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// Expire makes a top key expire after the given duration.
+func (c *Client) Expire(key string, d time.Duration) error {
+	_, e := c.request("expire", key, formatSeconds(d))
+	return e
+}
+
+// TTL returns the time left before a top key expires, or a negative duration if it does not expire.
+func (c *Client) TTL(key string) (time.Duration, error) {
+	r, e := c.request("ttl", key)
+	if e != nil {
+		return 0, e
+	}
+	if len(r) < 2 {
+		return 0, errors.New("ttl response missing seconds")
+	}
+	return parseSeconds(r[1])
+}
+
+// Persist removes the expiry of a top key.
+func (c *Client) Persist(key string) error {
+	_, e := c.request("persist", key)
+	return e
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpireLazy(t *testing.T) {
+	o := DbOptionsTest()
+	o.SweepInterval = time.Hour
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.NotNil(t, db.Expire("a", time.Second))
+	assert.Nil(t, db.Set("a", "b"))
+	d, e := db.TTL("a")
+	assert.Nil(t, e)
+	assert.True(t, d < 0)
+	assert.Nil(t, db.Expire("a", 10*time.Millisecond))
+	d, e = db.TTL("a")
+	assert.Nil(t, e)
+	assert.True(t, d > 0)
+	time.Sleep(20 * time.Millisecond)
+	_, e = db.Get("a")
+	assert.NotNil(t, e)
+	assert.Nil(t, db.Set("kept", "ex=60", "v"))
+	assert.Nil(t, db.Set("persisted", "ex=0.01", "v"))
+	assert.Nil(t, db.Persist("persisted"))
+	time.Sleep(20 * time.Millisecond)
+	v, e := db.Get("persisted")
+	assert.Nil(t, e)
+	assert.Equal(t, "v", v)
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	_, e = db.Get("a")
+	assert.NotNil(t, e)
+	v, e = db.Get("kept")
+	assert.Nil(t, e)
+	assert.Equal(t, "v", v)
+	d, e = db.TTL("kept")
+	assert.Nil(t, e)
+	assert.True(t, d > 59*time.Second)
+}
+
+func TestExpireSweep(t *testing.T) {
+	o := DbOptionsTest()
+	o.SweepInterval = 5 * time.Millisecond
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.Nil(t, db.Set("a", "ex=0.01", "b"))
+	time.Sleep(50 * time.Millisecond)
+	db.mu.Lock()
+	_, ok := db.d["a"]
+	db.mu.Unlock()
+	assert.False(t, ok)
+	assert.Nil(t, db.Set("b", "c"))
+	db.Close()
+	o.Overwrite = false
+	o.SweepInterval = time.Hour
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	db.mu.Lock()
+	_, ok = db.d["a"]
+	db.mu.Unlock()
+	assert.False(t, ok)
+}
+
+func TestClientExpire(t *testing.T) {
+	db, e := NewDb(DbOptionsTest())
+	defer db.Close()
+	assert.Nil(t, e)
+	c, e := NewClient(DefaultClientOptions())
+	defer c.Close()
+	assert.Nil(t, e)
+	assert.Nil(t, c.Set("a", "b"))
+	d, e := c.TTL("a")
+	assert.Nil(t, e)
+	assert.True(t, d < 0)
+	assert.Nil(t, c.Expire("a", time.Minute))
+	d, e = c.TTL("a")
+	assert.Nil(t, e)
+	assert.True(t, d > 59*time.Second)
+	assert.Nil(t, c.Persist("a"))
+	d, e = c.TTL("a")
+	assert.Nil(t, e)
+	assert.True(t, d < 0)
+	assert.NotNil(t, c.Expire("missing", time.Minute))
+}
+
+func TestExpireZeroSweepInterval(t *testing.T) {
+	o := DbOptionsTest()
+	o.SweepInterval = 0
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.Nil(t, db.Set("a", "b"))
+	db.Close()
+}
+
+func TestExpireSetSingleRecord(t *testing.T) {
+	o := DbOptionsTest()
+	o.SweepInterval = time.Hour
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.Nil(t, db.Set("a", "ex=60", "b"))
+	db.Close()
+	b, e := os.ReadFile(o.Filename)
+	assert.Nil(t, e)
+	assert.Equal(t, 1, strings.Count(string(b), "\n"))
+	assert.True(t, strings.HasPrefix(string(b), "set,a,exat="))
+	assert.True(t, strings.HasSuffix(string(b), ",b\n"))
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	d, e := db.TTL("a")
+	assert.Nil(t, e)
+	assert.True(t, d > 59*time.Second)
+}
@@ -0,0 +1,297 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// secondaryIndex maps the values of a field of the list elements under the top keys matching a pattern back to
+// those elements.
+type secondaryIndex struct {
+	pattern string
+	field   string
+	// refs maps each value of the field to the indexes of the elements holding it, by top key.
+	refs map[string]map[string][]int
+	// values holds the values found under each top key, so that they can be dropped when the key changes.
+	values map[string][]string
+}
+
+// IndexRef points at a list element found through a secondary index.
+type IndexRef struct {
+	Key   string `json:"key"`
+	Index int    `json:"index"`
+}
+
+func newSecondaryIndex(pattern, field string) *secondaryIndex {
+	return &secondaryIndex{pattern, field, map[string]map[string][]int{}, map[string][]string{}}
+}
+
+// update replaces the references held for a top key with those found in its stored value.
+func (x *secondaryIndex) update(key, stored string, exists bool) {
+	for _, v := range x.values[key] {
+		delete(x.refs[v], key)
+		if len(x.refs[v]) == 0 {
+			delete(x.refs, v)
+		}
+	}
+	delete(x.values, key)
+	if !exists {
+		return
+	}
+	s := storeValue{}
+	if e := json.NewDecoder(strings.NewReader(stored)).Decode(&s); e != nil {
+		return
+	}
+	for i, l := range s.L {
+		v, ok := l.M[x.field]
+		if !ok {
+			continue
+		}
+		if x.refs[v.V] == nil {
+			x.refs[v.V] = map[string][]int{}
+		}
+		if len(x.refs[v.V][key]) == 0 {
+			x.values[key] = append(x.values[key], v.V)
+		}
+		x.refs[v.V][key] = append(x.refs[v.V][key], i)
+	}
+}
+
+func (x *secondaryIndex) get(value string) []IndexRef {
+	refs := []IndexRef{}
+	for key, indexes := range x.refs[value] {
+		for _, i := range indexes {
+			refs = append(refs, IndexRef{key, i})
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Key != refs[j].Key {
+			return refs[i].Key < refs[j].Key
+		}
+		return refs[i].Index < refs[j].Index
+	})
+	return refs
+}
+
+// matchKey reports whether a top key matches a glob pattern. A * matches any run of characters, a ? matches any single
+// character, [...] matches a character class, which a leading ^ negates and which may hold ranges like a-z, and a \
+// makes the character after it literal. Top keys are not paths, so unlike path.Match a * also matches a /. Patterns
+// are checked with checkKeyPattern before use.
+func matchKey(pattern, key string) bool {
+	p, k := []rune(pattern), []rune(key)
+	pi, ki := 0, 0
+	// star is the position in the pattern just after the last * seen, and starKey where in the key it started
+	// matching, so that the * can be made to match one more character when the rest of the pattern fails.
+	star, starKey := -1, 0
+	for ki < len(k) {
+		if pi < len(p) {
+			switch p[pi] {
+			case '*':
+				pi++
+				star, starKey = pi, ki
+				continue
+			case '?':
+				pi++
+				ki++
+				continue
+			case '[':
+				ok, n, e := matchClass(p[pi:], k[ki])
+				if e != nil {
+					return false
+				}
+				if ok {
+					pi += n
+					ki++
+					continue
+				}
+			case '\\':
+				if pi+1 < len(p) && p[pi+1] == k[ki] {
+					pi += 2
+					ki++
+					continue
+				}
+			default:
+				if p[pi] == k[ki] {
+					pi++
+					ki++
+					continue
+				}
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		starKey++
+		pi, ki = star, starKey
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+// checkKeyPattern reports whether a glob pattern is malformed, as matchKey understands it.
+func checkKeyPattern(pattern string) error {
+	p := []rune(pattern)
+	for i := 0; i < len(p); i++ {
+		switch p[i] {
+		case '\\':
+			if i+1 == len(p) {
+				return errors.New("bad key pattern, trailing escape: " + pattern)
+			}
+			i++
+		case '[':
+			_, n, e := matchClass(p[i:], 0)
+			if e != nil {
+				return errors.New("bad key pattern, " + e.Error() + ": " + pattern)
+			}
+			i += n - 1
+		}
+	}
+	return nil
+}
+
+// matchClass matches a character against the character class at the start of p, returning whether it matched and
+// the length of the class.
+func matchClass(p []rune, c rune) (bool, int, error) {
+	i := 1
+	negate := i < len(p) && p[i] == '^'
+	if negate {
+		i++
+	}
+	matched := false
+	for first := true; ; first = false {
+		if i >= len(p) {
+			return false, 0, errors.New("unterminated character class")
+		}
+		if p[i] == ']' && !first {
+			break
+		}
+		lo, n, e := classChar(p, i)
+		if e != nil {
+			return false, 0, e
+		}
+		i += n
+		hi := lo
+		if i+1 < len(p) && p[i] == '-' && p[i+1] != ']' {
+			if hi, n, e = classChar(p, i+1); e != nil {
+				return false, 0, e
+			}
+			i += 1 + n
+			if hi < lo {
+				return false, 0, errors.New("bad character range")
+			}
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+	}
+	return matched != negate, i + 1, nil
+}
+
+// classChar reads the possibly escaped character at p[i] of a character class, returning it and its length.
+func classChar(p []rune, i int) (rune, int, error) {
+	if p[i] != '\\' {
+		return p[i], 1, nil
+	}
+	if i+1 >= len(p) {
+		return 0, 0, errors.New("unterminated character class")
+	}
+	return p[i+1], 2, nil
+}
+
+// CreateIndex starts indexing the field of the maps of the list elements under every top key matching the glob
+// pattern, so that IndexGet can find them by value.
+func (db *Db) CreateIndex(name, pattern, field string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.createIndex(name, pattern, field)
+}
+
+func (db *Db) createIndex(name, pattern, field string) error {
+	if _, ok := db.indexes[name]; ok {
+		return errors.New("index already exists: " + name)
+	}
+	if e := checkKeyPattern(pattern); e != nil {
+		return e
+	}
+	db.touchIndexes()
+	x := newSecondaryIndex(pattern, field)
+	for key, v := range db.d {
+		if matchKey(pattern, key) {
+			x.update(key, v, true)
+		}
+	}
+	db.indexes[name] = x
+	db.logM("index-create", name, pattern, field)
+	return nil
+}
+
+// DropIndex removes a secondary index.
+func (db *Db) DropIndex(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.dropIndex(name)
+}
+
+func (db *Db) dropIndex(name string) error {
+	if _, ok := db.indexes[name]; !ok {
+		return errors.New("no such index: " + name)
+	}
+	db.touchIndexes()
+	delete(db.indexes, name)
+	db.logM("index-drop", name)
+	return nil
+}
+
+// IndexGet returns the list elements whose indexed field holds the value, ordered by top key and index.
+func (db *Db) IndexGet(name, value string) ([]IndexRef, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.indexGet(name, value)
+}
+
+func (db *Db) indexGet(name, value string) ([]IndexRef, error) {
+	x, ok := db.indexes[name]
+	if !ok {
+		return nil, errors.New("no such index: " + name)
+	}
+	return x.get(value), nil
+}
+
+// reindex brings every secondary index covering a top key up to date with its current value.
+func (db *Db) reindex(key string) {
+	v, exists := db.d[key]
+	for _, x := range db.indexes {
+		if matchKey(x.pattern, key) {
+			x.update(key, v, exists)
+		}
+	}
+}
+
+// CreateIndex starts indexing the field of the list elements under every top key matching the pattern.
+func (c *Client) CreateIndex(name, pattern, field string) error {
+	_, e := c.request("index-create", name, pattern, field)
+	return e
+}
+
+// DropIndex removes a secondary index.
+func (c *Client) DropIndex(name string) error {
+	_, e := c.request("index-drop", name)
+	return e
+}
+
+// IndexGet returns the list elements whose indexed field holds the value.
+func (c *Client) IndexGet(name, value string) ([]IndexRef, error) {
+	r, e := c.request("index-get", name, value)
+	if e != nil {
+		return nil, e
+	}
+	var refs []IndexRef
+	if e = json.Unmarshal([]byte(r[1]), &refs); e != nil {
+		return nil, e
+	}
+	return refs, nil
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSecondaryIndex(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.Nil(t, db.SetJSON("thread:1", `[{"author":"jack"},{"author":"tom"}]`))
+	assert.Nil(t, db.SetJSON("other", `[{"author":"jack"}]`))
+	assert.Nil(t, db.CreateIndex("authors", "thread:*", "author"))
+	assert.NotNil(t, db.CreateIndex("authors", "thread:*", "author"))
+	assert.Nil(t, db.Set("thread:2", "+", "+", "->", "author", "jack"))
+	refs, e := db.IndexGet("authors", "jack")
+	assert.Nil(t, e)
+	assert.Equal(t, []IndexRef{{"thread:1", 0}, {"thread:2", 0}}, refs)
+	assert.Nil(t, db.Set("thread:1", "+", "0", "->", "author", "tom"))
+	refs, e = db.IndexGet("authors", "tom")
+	assert.Nil(t, e)
+	assert.Equal(t, []IndexRef{{"thread:1", 0}, {"thread:1", 1}}, refs)
+	_, e = db.Exec([]string{"set", "thread:3", "+", "+", "->", "author", "tom"}, []string{"get", "missing"})
+	assert.NotNil(t, e)
+	refs, e = db.IndexGet("authors", "tom")
+	assert.Nil(t, e)
+	assert.Len(t, refs, 2)
+	_, e = db.IndexGet("missing", "tom")
+	assert.NotNil(t, e)
+	v, e := db.Get("thread:1", "+", "0", "->", "author")
+	assert.Nil(t, e)
+	assert.Equal(t, "tom", v)
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	refs, e = db.IndexGet("authors", "jack")
+	assert.Nil(t, e)
+	assert.Equal(t, []IndexRef{{"thread:2", 0}}, refs)
+	assert.Nil(t, db.DropIndex("authors"))
+	_, e = db.IndexGet("authors", "jack")
+	assert.NotNil(t, e)
+}
+
+func TestMatchKey(t *testing.T) {
+	for _, c := range []struct {
+		pattern, key string
+		match        bool
+	}{
+		{"thread:*", "thread:2024/05", true},
+		{"*", "a/b/c", true},
+		{"*/05", "thread:2024/05", true},
+		{"thread:?", "thread:1", true},
+		{"thread:?", "thread:12", false},
+		{"thread:[0-9]", "thread:7", true},
+		{"thread:[^0-9]", "thread:7", false},
+		{"thread:[]x]", "thread:]", true},
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{"a*b*c", "abxbyc", true},
+		{"a*b*c", "abxbyd", false},
+	} {
+		assert.Nil(t, checkKeyPattern(c.pattern))
+		assert.Equal(t, c.match, matchKey(c.pattern, c.key), c.pattern+" "+c.key)
+	}
+	for _, p := range []string{"[", "a[b", "[z-a]", `a\`, `[\`} {
+		assert.NotNil(t, checkKeyPattern(p), p)
+	}
+}
+
+func TestSecondaryIndexSlashKey(t *testing.T) {
+	db, e := NewDb(DbOptionsTest())
+	defer db.Close()
+	assert.Nil(t, e)
+	assert.Nil(t, db.CreateIndex("authors", "thread:*", "author"))
+	assert.Nil(t, db.Set("thread:2024/05", "+", "+", "->", "author", "jack"))
+	refs, e := db.IndexGet("authors", "jack")
+	assert.Nil(t, e)
+	assert.Equal(t, []IndexRef{{"thread:2024/05", 0}}, refs)
+	assert.NotNil(t, db.CreateIndex("bad", "[", "author"))
+}
+
+func TestClientSecondaryIndex(t *testing.T) {
+	db, e := NewDb(DbOptionsTest())
+	defer db.Close()
+	assert.Nil(t, e)
+	c, e := NewClient(DefaultClientOptions())
+	defer c.Close()
+	assert.Nil(t, e)
+	assert.Nil(t, c.CreateIndex("authors", "thread:*", "author"))
+	assert.Nil(t, c.Set("thread:1", "+", "+", "->", "author", "jack"))
+	refs, e := c.IndexGet("authors", "jack")
+	assert.Nil(t, e)
+	assert.Equal(t, []IndexRef{{"thread:1", 0}}, refs)
+	refs, e = c.IndexGet("authors", "nobody")
+	assert.Nil(t, e)
+	assert.Empty(t, refs)
+	assert.Nil(t, c.DropIndex("authors"))
+	assert.NotNil(t, c.DropIndex("authors"))
+}
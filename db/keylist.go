@@ -0,0 +1,105 @@
+package db
+
+import "math/rand"
+
+// keyListLevels bounds the height of a keyList, which comfortably holds billions of keys.
+const keyListLevels = 32
+
+// keyList is a skip list holding the top keys in order, kept alongside the map of values so that keys can be
+// scanned and ranged over without sorting them every time.
+type keyList struct {
+	head  *keyNode
+	level int
+}
+
+type keyNode struct {
+	key  string
+	next []*keyNode
+	// prev is the previous node on the bottom level, or nil for the first node.
+	prev *keyNode
+}
+
+func newKeyList() *keyList {
+	return &keyList{head: &keyNode{next: make([]*keyNode, keyListLevels)}, level: 1}
+}
+
+// path returns, for each level, the last node whose key is before the given key.
+func (l *keyList) path(key string) [keyListLevels]*keyNode {
+	var update [keyListLevels]*keyNode
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	return update
+}
+
+// insert adds a key, unless the list already holds it.
+func (l *keyList) insert(key string) {
+	update := l.path(key)
+	if n := update[0].next[0]; n != nil && n.key == key {
+		return
+	}
+	level := 1
+	for level < keyListLevels && rand.Intn(4) == 0 {
+		level++
+	}
+	for i := l.level; i < level; i++ {
+		update[i] = l.head
+	}
+	if level > l.level {
+		l.level = level
+	}
+	n := &keyNode{key: key, next: make([]*keyNode, level)}
+	for i := 0; i < level; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+	if update[0] != l.head {
+		n.prev = update[0]
+	}
+	if n.next[0] != nil {
+		n.next[0].prev = n
+	}
+}
+
+// remove deletes a key, if the list holds it. The removed node keeps its links, so a walk standing on it can go on.
+func (l *keyList) remove(key string) {
+	update := l.path(key)
+	n := update[0].next[0]
+	if n == nil || n.key != key {
+		return
+	}
+	for i := range n.next {
+		update[i].next[i] = n.next[i]
+	}
+	if n.next[0] != nil {
+		n.next[0].prev = n.prev
+	}
+}
+
+// seek returns the first node whose key is not before the given key, or nil.
+func (l *keyList) seek(key string) *keyNode {
+	return l.path(key)[0].next[0]
+}
+
+// before returns the last node whose key is before the given key, or the last node when the key is empty.
+func (l *keyList) before(key string) *keyNode {
+	var x *keyNode
+	if len(key) == 0 {
+		x = l.head
+		for i := l.level - 1; i >= 0; i-- {
+			for x.next[i] != nil {
+				x = x.next[i]
+			}
+		}
+	} else {
+		x = l.path(key)[0]
+	}
+	if x == l.head {
+		return nil
+	}
+	return x
+}
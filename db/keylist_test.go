@@ -0,0 +1,64 @@
+package db
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func keyListKeys(l *keyList) []string {
+	keys := []string{}
+	for n := l.seek(""); n != nil; n = n.next[0] {
+		keys = append(keys, n.key)
+	}
+	return keys
+}
+
+func TestKeyList(t *testing.T) {
+	l := newKeyList()
+	assert.Nil(t, l.seek(""))
+	assert.Nil(t, l.before(""))
+	want := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		k := fmt.Sprintf("k%d", rand.Intn(300))
+		if rand.Intn(3) == 0 {
+			l.remove(k)
+			delete(want, k)
+		} else {
+			l.insert(k)
+			want[k] = true
+		}
+	}
+	sorted := []string{}
+	for k := range want {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	assert.Equal(t, sorted, keyListKeys(l))
+	backwards := []string{}
+	for n := l.before(""); n != nil; n = n.prev {
+		backwards = append([]string{n.key}, backwards...)
+	}
+	assert.Equal(t, sorted, backwards)
+}
+
+func TestKeyListSeek(t *testing.T) {
+	l := newKeyList()
+	for _, k := range []string{"b", "d", "f"} {
+		l.insert(k)
+	}
+	l.insert("d")
+	assert.Equal(t, []string{"b", "d", "f"}, keyListKeys(l))
+	assert.Equal(t, "d", l.seek("c").key)
+	assert.Equal(t, "d", l.seek("d").key)
+	assert.Nil(t, l.seek("g"))
+	assert.Equal(t, "b", l.before("c").key)
+	assert.Equal(t, "b", l.before("d").key)
+	assert.Nil(t, l.before("b"))
+	assert.Equal(t, "f", l.before("").key)
+	l.remove("d")
+	l.remove("x")
+	assert.Equal(t, "b", l.seek("f").prev.key)
+}
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// walk calls f with each live top key from a node of the ordered keys on, forwards or backwards, until f returns
+// false. Keys which are due to expire are deleted on the way.
+func (db *Db) walk(n *keyNode, reverse bool, f func(key string) bool) {
+	for n != nil {
+		k := n.key
+		if reverse {
+			n = n.prev
+		} else {
+			n = n.next[0]
+		}
+		db.expireIfDue(k)
+		if _, ok := db.d[k]; !ok {
+			continue
+		}
+		if !f(k) {
+			return
+		}
+	}
+}
+
+// Keys returns the top keys matching a glob pattern, as understood by matchKey, in order. It walks every key, so
+// prefer Scan on big datasets.
+func (db *Db) Keys(pattern string) ([]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.keys(pattern)
+}
+
+func (db *Db) keys(pattern string) ([]string, error) {
+	if e := checkKeyPattern(pattern); e != nil {
+		db.logM("errorkeys", e.Error())
+		return nil, e
+	}
+	keys := []string{}
+	db.walk(db.ordered.seek(""), false, func(k string) bool {
+		if matchKey(pattern, k) {
+			keys = append(keys, k)
+		}
+		return true
+	})
+	return keys, nil
+}
+
+// Scan returns up to count top keys starting with the prefix, in order, from just after the cursor. An empty cursor
+// starts from the first key. The returned cursor is the last key returned, or empty once there are no keys left.
+// The cursor is a key rather than a position, so it keeps working while keys are written: a scan sees every key
+// which exists for its whole length exactly once.
+func (db *Db) Scan(cursor, prefix string, count int) ([]string, string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.scan(cursor, prefix, count)
+}
+
+func (db *Db) scan(cursor, prefix string, count int) ([]string, string, error) {
+	if count <= 0 {
+		e := errors.New(fmt.Sprintf("scan count should be positive, saw %d", count))
+		db.logM("errorscan", e.Error())
+		return nil, "", e
+	}
+	start := cursor
+	if start < prefix {
+		start = prefix
+	}
+	keys := []string{}
+	more := false
+	db.walk(db.ordered.seek(start), false, func(k string) bool {
+		if len(cursor) != 0 && k == cursor {
+			return true
+		}
+		if !strings.HasPrefix(k, prefix) {
+			return false
+		}
+		if len(keys) == count {
+			more = true
+			return false
+		}
+		keys = append(keys, k)
+		return true
+	})
+	if !more {
+		return keys, "", nil
+	}
+	return keys, keys[len(keys)-1], nil
+}
+
+// Range returns up to limit top keys from start, included, to end, excluded, in order. An empty end has no bound,
+// and a limit of zero has no limit.
+func (db *Db) Range(start, end string, limit int) ([]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.rangeKeys(start, end, limit, false)
+}
+
+// RevRange is like Range, but returns the keys in reverse order, starting from the last key before end.
+func (db *Db) RevRange(start, end string, limit int) ([]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.rangeKeys(start, end, limit, true)
+}
+
+func (db *Db) rangeKeys(start, end string, limit int, reverse bool) ([]string, error) {
+	if limit < 0 {
+		e := errors.New(fmt.Sprintf("range limit should not be negative, saw %d", limit))
+		db.logM("errorrange", e.Error())
+		return nil, e
+	}
+	n := db.ordered.seek(start)
+	if reverse {
+		n = db.ordered.before(end)
+	}
+	keys := []string{}
+	db.walk(n, reverse, func(k string) bool {
+		if k < start || (len(end) != 0 && k >= end) {
+			return false
+		}
+		keys = append(keys, k)
+		return limit == 0 || len(keys) < limit
+	})
+	return keys, nil
+}
+
+// KeyIterator walks the top keys starting with a prefix, a batch of keys at a time, like a bufio.Scanner:
+//
+//	it := db.Iterate("thread:")
+//	for it.Next() {
+//		fmt.Println(it.Key())
+//	}
+//	if e := it.Err(); e != nil {
+//		...
+//	}
+type KeyIterator struct {
+	scan   func(cursor string) ([]string, string, error)
+	cursor string
+	batch  []string
+	key    string
+	done   bool
+	e      error
+}
+
+// Next moves to the next key, reporting whether there is one.
+func (it *KeyIterator) Next() bool {
+	for len(it.batch) == 0 {
+		if it.done || it.e != nil {
+			return false
+		}
+		it.batch, it.cursor, it.e = it.scan(it.cursor)
+		it.done = len(it.cursor) == 0
+	}
+	it.key, it.batch = it.batch[0], it.batch[1:]
+	return true
+}
+
+// Key returns the key which Next moved to.
+func (it *KeyIterator) Key() string {
+	return it.key
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *KeyIterator) Err() error {
+	return it.e
+}
+
+const iterateBatch = 100
+
+// Iterate returns an iterator over the top keys starting with the prefix. Each batch of keys is scanned under its
+// own lock, so writes can go on while iterating.
+func (db *Db) Iterate(prefix string) *KeyIterator {
+	return &KeyIterator{scan: func(cursor string) ([]string, string, error) {
+		return db.Scan(cursor, prefix, iterateBatch)
+	}}
+}
+
+// Keys returns the top keys matching a glob pattern, in order.
+func (c *Client) Keys(pattern string) ([]string, error) {
+	r, e := c.request("keys", pattern)
+	if e != nil {
+		return nil, e
+	}
+	return r[1:], nil
+}
+
+// Scan returns up to count top keys starting with the prefix from just after the cursor, along with the cursor to
+// scan from next, which is empty once there are no keys left.
+func (c *Client) Scan(cursor, prefix string, count int) ([]string, string, error) {
+	r, e := c.request("scan", cursor, prefix, strconv.Itoa(count))
+	if e != nil {
+		return nil, "", e
+	}
+	return r[2:], r[1], nil
+}
+
+// Range returns up to limit top keys from start, included, to end, excluded, in order.
+func (c *Client) Range(start, end string, limit int) ([]string, error) {
+	return c.rangeKeys("range", start, end, limit)
+}
+
+// RevRange is like Range, but returns the keys in reverse order.
+func (c *Client) RevRange(start, end string, limit int) ([]string, error) {
+	return c.rangeKeys("revrange", start, end, limit)
+}
+
+func (c *Client) rangeKeys(name, start, end string, limit int) ([]string, error) {
+	r, e := c.request(name, start, end, strconv.Itoa(limit))
+	if e != nil {
+		return nil, e
+	}
+	return r[1:], nil
+}
+
+// Iterate returns an iterator over the top keys starting with the prefix, fetching them a batch at a time.
+func (c *Client) Iterate(prefix string) *KeyIterator {
+	return &KeyIterator{scan: func(cursor string) ([]string, string, error) {
+		return c.Scan(cursor, prefix, iterateBatch)
+	}}
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestKeys(t *testing.T) {
+	db, e := NewDb(DbOptionsTest())
+	defer db.Close()
+	assert.Nil(t, e)
+	assert.Nil(t, db.MSet("thread:2", "b", "thread:1", "a", "user:1", "c", "gone", "d"))
+	assert.Nil(t, db.Expire("gone", time.Nanosecond))
+	time.Sleep(time.Millisecond)
+	keys, e := db.Keys("thread:*")
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"thread:1", "thread:2"}, keys)
+	keys, e = db.Keys("*")
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"thread:1", "thread:2", "user:1"}, keys)
+	_, e = db.Keys("[")
+	assert.NotNil(t, e)
+	assert.Nil(t, db.Set("thread:2024/05", "e"))
+	keys, e = db.Keys("*")
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"thread:1", "thread:2", "thread:2024/05", "user:1"}, keys)
+	keys, e = db.Keys("thread:*")
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"thread:1", "thread:2", "thread:2024/05"}, keys)
+}
+
+func TestScan(t *testing.T) {
+	db, e := NewDb(DbOptionsTest())
+	defer db.Close()
+	assert.Nil(t, e)
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, db.Set(fmt.Sprintf("thread:%d", i), "x"))
+	}
+	assert.Nil(t, db.Set("a", "x"))
+	assert.Nil(t, db.Set("user:1", "x"))
+	keys, cursor, e := db.Scan("", "thread:", 2)
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"thread:0", "thread:1"}, keys)
+	assert.Equal(t, "thread:1", cursor)
+	assert.Nil(t, db.Set("thread:00", "x"))
+	assert.Nil(t, db.Rename("thread:2", "to", "user:2"))
+	keys, cursor, e = db.Scan(cursor, "thread:", 2)
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"thread:3", "thread:4"}, keys)
+	assert.Equal(t, "", cursor)
+	_, _, e = db.Scan("", "", 0)
+	assert.NotNil(t, e)
+	it := db.Iterate("")
+	keys = []string{}
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, []string{"a", "thread:0", "thread:00", "thread:1", "thread:3", "thread:4", "user:1", "user:2"}, keys)
+}
+
+func TestClientKeys(t *testing.T) {
+	db, e := NewDb(DbOptionsTest())
+	defer db.Close()
+	assert.Nil(t, e)
+	c, e := NewClient(DefaultClientOptions())
+	defer c.Close()
+	assert.Nil(t, e)
+	for i := 0; i < 250; i++ {
+		assert.Nil(t, c.Set(fmt.Sprintf("k,%03d", i), "x"))
+	}
+	keys, e := c.Keys("k,00?")
+	assert.Nil(t, e)
+	assert.Equal(t, 10, len(keys))
+	keys, cursor, e := c.Scan("", "k,1", 3)
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"k,100", "k,101", "k,102"}, keys)
+	assert.Equal(t, "k,102", cursor)
+	it := c.Iterate("k,")
+	n := 0
+	for it.Next() {
+		assert.Equal(t, fmt.Sprintf("k,%03d", n), it.Key())
+		n++
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, 250, n)
+}
+
+func TestRange(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.Nil(t, db.MSet(
+		"thread:2024-04-30:a", "x",
+		"thread:2024-05-01:b", "x",
+		"thread:2024-05-17:c", "x",
+		"thread:2024-05-31:d", "x",
+		"thread:2024-06-01:e", "x"))
+	keys, e := db.Range("thread:2024-05", "thread:2024-06", 0)
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"thread:2024-05-01:b", "thread:2024-05-17:c", "thread:2024-05-31:d"}, keys)
+	keys, e = db.RevRange("thread:2024-05", "thread:2024-06", 2)
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"thread:2024-05-31:d", "thread:2024-05-17:c"}, keys)
+	keys, e = db.RevRange("", "", 1)
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"thread:2024-06-01:e"}, keys)
+	_, e = db.Range("", "", -1)
+	assert.NotNil(t, e)
+	assert.Nil(t, db.Move("thread:2024-05-17:c", "to", "thread:2024-07-01:c"))
+	_, e = db.Exec([]string{"set", "thread:2024-05-02:f", "x"}, []string{"incr", "thread:2024-05-01:b", "1"})
+	assert.NotNil(t, e)
+	keys, e = db.Range("thread:2024-05", "thread:2024-06", 0)
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"thread:2024-05-01:b", "thread:2024-05-31:d"}, keys)
+	db.Get("thread:2024-07-01:c")
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	keys, e = db.RevRange("thread:2024-06", "", 0)
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"thread:2024-07-01:c", "thread:2024-06-01:e"}, keys)
+}
+
+func TestClientRange(t *testing.T) {
+	db, e := NewDb(DbOptionsTest())
+	defer db.Close()
+	assert.Nil(t, e)
+	c, e := NewClient(DefaultClientOptions())
+	defer c.Close()
+	assert.Nil(t, e)
+	assert.Nil(t, c.MSet(map[string]string{"a": "1", "b": "2", "c": "3"}))
+	keys, e := c.Range("b", "", 0)
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"b", "c"}, keys)
+	keys, e = c.RevRange("", "c", 0)
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"b", "a"}, keys)
+	_, e = c.Range("a", "c", -1)
+	assert.NotNil(t, e)
+}
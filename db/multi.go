@@ -0,0 +1,197 @@
+package db
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errTornRecord is returned when replaying an exec record which was cut short while it was being written.
+var errTornRecord = errors.New("db log record was not fully written")
+
+// transaction holds what is needed to undo the requests run by an exec, along with the records they logged, which
+// are written out together once all of them succeed.
+type transaction struct {
+	undo map[string]undoState
+	log  [][]string
+	// indexes holds the secondary indexes from before the transaction first created or dropped one.
+	indexes map[string]*secondaryIndex
+}
+
+// undoState is the state of a top key before a transaction first changed it.
+type undoState struct {
+	value    string
+	exists   bool
+	version  int64
+	deadline time.Time
+	expiring bool
+}
+
+// Exec runs the requests atomically, returning the reply of each one. Either all of them succeed and are logged as
+// a single record, or none of them has any effect, in which case the error of the failing request is returned, or
+// ErrConflict if one of its preconditions did not hold.
+func (db *Db) Exec(requests ...[]string) ([][]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return decodeExecReply(db.exec(requests))
+}
+
+// exec runs queued requests as a transaction and returns the reply to send back. The caller must hold the engine
+// lock.
+func (db *Db) exec(requests [][]string) []string {
+	db.tx = &transaction{undo: map[string]undoState{}}
+	replies := []string{"ok"}
+	for i, r := range requests {
+		reply, _ := db.respond(r)
+		if reply[0] == "error" {
+			db.rollback()
+			return []string{"error", fmt.Sprintf("command %d: %s", i, reply[1])}
+		}
+		if reply[0] != "ok" {
+			db.rollback()
+			return reply
+		}
+		replies = append(replies, encodeRecord(reply))
+	}
+	log := db.tx.log
+	db.tx = nil
+	if len(log) > 0 {
+		records := []string{strconv.Itoa(len(log))}
+		for _, r := range log {
+			records = append(records, encodeRecord(r))
+		}
+		db.logM("exec", records...)
+	}
+	return replies
+}
+
+// touch remembers the state of a top key before the running transaction first changes it.
+func (db *Db) touch(key string) {
+	if db.tx == nil {
+		return
+	}
+	if _, ok := db.tx.undo[key]; ok {
+		return
+	}
+	u := undoState{version: db.versions[key]}
+	u.value, u.exists = db.d[key]
+	u.deadline, u.expiring = db.expires[key]
+	db.tx.undo[key] = u
+}
+
+// touchIndexes remembers the secondary indexes before the running transaction first creates or drops one.
+func (db *Db) touchIndexes() {
+	if db.tx == nil || db.tx.indexes != nil {
+		return
+	}
+	db.tx.indexes = make(map[string]*secondaryIndex, len(db.indexes))
+	for name, x := range db.indexes {
+		db.tx.indexes[name] = x
+	}
+}
+
+// rollback undoes every change made by the running transaction, and drops the records it logged.
+func (db *Db) rollback() {
+	for key, u := range db.tx.undo {
+		if u.exists {
+			db.d[key] = u.value
+			db.ordered.insert(key)
+		} else {
+			delete(db.d, key)
+			db.ordered.remove(key)
+		}
+		db.versions[key] = u.version
+		if u.expiring {
+			db.expires[key] = u.deadline
+		} else {
+			delete(db.expires, key)
+		}
+	}
+	if db.tx.indexes != nil {
+		db.indexes = db.tx.indexes
+	}
+	for key := range db.tx.undo {
+		db.reindex(key)
+	}
+	db.tx = nil
+}
+
+// replayExec applies every record held by a logged exec record, or none of them if the record is torn.
+func (db *Db) replayExec(record []string) error {
+	if len(record) < 2 {
+		return errTornRecord
+	}
+	n, e := strconv.Atoi(record[1])
+	if e != nil || n != len(record)-2 {
+		return errTornRecord
+	}
+	records := make([][]string, n)
+	for i, r := range record[2:] {
+		if records[i], e = decodeRecord(r); e != nil {
+			return errTornRecord
+		}
+	}
+	for _, r := range records {
+		if e = db.replay(r); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// encodeRecord writes a record as a single csv line, so that it can be nested as a field of another record.
+func encodeRecord(r []string) string {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write(r)
+	w.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func decodeRecord(s string) ([]string, error) {
+	return csv.NewReader(strings.NewReader(s)).Read()
+}
+
+// decodeExecReply turns the reply to an exec into the replies of each of its requests.
+func decodeExecReply(reply []string) ([][]string, error) {
+	switch reply[0] {
+	case "conflict":
+		return nil, ErrConflict
+	case "error":
+		return nil, errors.New(reply[1])
+	}
+	replies := make([][]string, len(reply)-1)
+	for i, r := range reply[1:] {
+		var e error
+		if replies[i], e = decodeRecord(r); e != nil {
+			return nil, e
+		}
+	}
+	return replies, nil
+}
+
+// Exec runs the requests atomically on the server through a multi call, returning the reply of each one.
+func (c *Client) Exec(requests ...[]string) ([][]string, error) {
+	if _, e := c.request("multi"); e != nil {
+		return nil, e
+	}
+	for _, r := range requests {
+		if _, e := c.request(r...); e != nil {
+			c.request("discard")
+			return nil, e
+		}
+	}
+	writer := csv.NewWriter(c.conn)
+	if e := writer.Write([]string{"exec"}); e != nil {
+		return nil, e
+	}
+	writer.Flush()
+	reply, e := csv.NewReader(c.conn).Read()
+	if e != nil {
+		return nil, e
+	}
+	return decodeExecReply(reply)
+}
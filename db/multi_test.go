@@ -0,0 +1,100 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestExec(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.Nil(t, db.Set("from", "+", "+", "comment"))
+	replies, e := db.Exec(
+		[]string{"set", "to", "+", "+", "comment"},
+		[]string{"set", "from", "+", "0", "moved"},
+		[]string{"incr", "moves", "1"},
+	)
+	assert.Nil(t, e)
+	assert.Equal(t, [][]string{{"ok"}, {"ok"}, {"ok", "1"}}, replies)
+	_, e = db.Exec(
+		[]string{"set", "to", "+", "+", "second"},
+		[]string{"incr", "from", "+", "0", "1"},
+	)
+	assert.NotNil(t, e)
+	_, e = db.Exec(
+		[]string{"set", "to", "+", "+", "second"},
+		[]string{"set", "moves", "if-version=0", "0"},
+	)
+	assert.Equal(t, ErrConflict, e)
+	v, version, e := db.GetWithVersion("to", "+", "1")
+	assert.NotNil(t, e)
+	v, version, e = db.GetWithVersion("to", "+", "0")
+	assert.Nil(t, e)
+	assert.Equal(t, "comment", v)
+	assert.Equal(t, int64(1), version)
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	v, e = db.Get("from", "+", "0")
+	assert.Nil(t, e)
+	assert.Equal(t, "moved", v)
+	v, e = db.Get("moves")
+	assert.Nil(t, e)
+	assert.Equal(t, "1", v)
+}
+
+func TestExecTornRecord(t *testing.T) {
+	o := DbOptionsTest()
+	o.Overwrite = false
+	for _, tail := range []string{
+		"set,a,b\nexec,2,\"set,a,c\"\n",
+		"set,a,b\nexec,2,\"set,a,c\",\"set,d",
+		"set,a,b",
+	} {
+		f, e := os.Create(o.Filename)
+		assert.Nil(t, e)
+		f.WriteString(tail)
+		f.Close()
+		db, e := NewDb(o)
+		assert.Nil(t, e)
+		v, e := db.Get("a")
+		assert.Nil(t, e)
+		assert.Equal(t, "b", v)
+		// Writes made after recovery must survive the next restart, rather than be glued onto the torn record.
+		assert.Nil(t, db.Set("c", "3"))
+		db.Get("c")
+		db.Close()
+		db, e = NewDb(o)
+		assert.Nil(t, e)
+		v, e = db.Get("c")
+		assert.Nil(t, e)
+		assert.Equal(t, "3", v)
+		v, e = db.Get("a")
+		assert.Nil(t, e)
+		assert.Equal(t, "b", v)
+		db.Close()
+	}
+}
+
+func TestClientExec(t *testing.T) {
+	db, e := NewDb(DbOptionsTest())
+	defer db.Close()
+	assert.Nil(t, e)
+	c, e := NewClient(DefaultClientOptions())
+	defer c.Close()
+	assert.Nil(t, e)
+	replies, e := c.Exec([]string{"set", "a", "b"}, []string{"get", "a"})
+	assert.Nil(t, e)
+	assert.Equal(t, [][]string{{"ok"}, {"ok", "b"}}, replies)
+	_, e = c.Exec([]string{"set", "a", "c"}, []string{"get", "missing"})
+	assert.NotNil(t, e)
+	_, e = c.Exec([]string{"set", "a", "if-version=0", "c"})
+	assert.Equal(t, ErrConflict, e)
+	v, e := c.Get("a")
+	assert.Nil(t, e)
+	assert.Equal(t, "b", v)
+}
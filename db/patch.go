@@ -0,0 +1,371 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// handleMerge deep merges the json document held by the command into the value at the command's path, the way
+// RFC 7386 describes: objects are merged key by key, null deletes a key, and anything else replaces the target.
+// Merging an object into a value keeps that value's string and list.
+func handleMerge(previous string, c *command) (string, error) {
+	j, e := decodeJson(c.set_value)
+	if e != nil {
+		return "", e
+	}
+	s := decodeStored(previous)
+	s, e = changeMapValue(s, c.pos, func(target storeValue) (storeValue, error) {
+		return mergeJson(target, j)
+	})
+	if e != nil {
+		return "", e
+	}
+	return encodeStored(s)
+}
+
+func mergeJson(target storeValue, j interface{}) (storeValue, error) {
+	patch, ok := j.(map[string]interface{})
+	if !ok {
+		return fromJson(j)
+	}
+	if target.M == nil {
+		target.M = make(map[string]storeValue, len(patch))
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(target.M, k)
+			continue
+		}
+		nv, e := mergeJson(target.M[k], v)
+		if e != nil {
+			return target, e
+		}
+		target.M[k] = nv
+	}
+	return target, nil
+}
+
+// decodeJson decodes a single json document, keeping numbers as they were written.
+func decodeJson(doc string) (interface{}, error) {
+	d := json.NewDecoder(strings.NewReader(doc))
+	d.UseNumber()
+	var j interface{}
+	if e := d.Decode(&j); e != nil {
+		return nil, errors.New(fmt.Sprintf("bad json document: %v", e))
+	}
+	if d.More() {
+		return nil, errors.New("bad json document: trailing data")
+	}
+	return j, nil
+}
+
+// PatchOperation is a single operation of an RFC 6902 json patch.
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// MarshalJSON always writes the value of add, replace and test operations, so that a nil Value is sent as null
+// rather than left out.
+func (o PatchOperation) MarshalJSON() ([]byte, error) {
+	type operation PatchOperation
+	switch o.Op {
+	case "add", "replace", "test":
+		return json.Marshal(struct {
+			operation
+			Value interface{} `json:"value"`
+		}{operation(o), o.Value})
+	}
+	return json.Marshal(operation(o))
+}
+
+// handlePatch applies an RFC 6902 json patch to a stored value. Pointer tokens index into a value's list when it
+// has one and the token is an index, or "-" to append, and into its map otherwise.
+func handlePatch(previous string, doc string) (string, error) {
+	var ops []struct {
+		Op    string
+		Path  *string
+		From  *string
+		Value json.RawMessage
+	}
+	d := json.NewDecoder(strings.NewReader(doc))
+	d.UseNumber()
+	if e := d.Decode(&ops); e != nil {
+		return "", errors.New(fmt.Sprintf("bad json patch: %v", e))
+	}
+	s := decodeStored(previous)
+	for i, op := range ops {
+		if op.Path == nil {
+			return "", errors.New(fmt.Sprintf("patch operation %d has no path", i))
+		}
+		path, e := parsePointer(*op.Path)
+		if e != nil {
+			return "", e
+		}
+		var from []string
+		if op.Op == "move" || op.Op == "copy" {
+			if op.From == nil {
+				return "", errors.New(fmt.Sprintf("patch operation %d has no from", i))
+			}
+			if from, e = parsePointer(*op.From); e != nil {
+				return "", e
+			}
+		}
+		var value storeValue
+		if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+			if op.Value == nil {
+				return "", errors.New(fmt.Sprintf("patch operation %d has no value", i))
+			}
+			j, e := decodeJson(string(op.Value))
+			if e != nil {
+				return "", e
+			}
+			if value, e = fromJson(j); e != nil {
+				return "", e
+			}
+		}
+		switch op.Op {
+		case "add":
+			s, e = pointerAdd(s, path, value)
+		case "remove":
+			s, _, e = pointerRemove(s, path)
+		case "replace":
+			if s, _, e = pointerRemove(s, path); e == nil {
+				s, e = pointerAdd(s, path, value)
+			}
+		case "move":
+			var v storeValue
+			if s, v, e = pointerRemove(s, from); e == nil {
+				s, e = pointerAdd(s, path, v)
+			}
+		case "copy":
+			var v storeValue
+			if v, e = pointerGet(s, from); e == nil {
+				s, e = pointerAdd(s, path, cloneValue(v))
+			}
+		case "test":
+			var v storeValue
+			if v, e = pointerGet(s, path); e == nil {
+				a, _ := json.Marshal(plainJson(v))
+				b, _ := json.Marshal(plainJson(value))
+				if string(a) != string(b) {
+					e = errors.New(fmt.Sprintf("patch test failed at %s", *op.Path))
+				}
+			}
+		default:
+			e = errors.New(fmt.Sprintf("unknown patch operation %q", op.Op))
+		}
+		if e != nil {
+			return "", errors.New(fmt.Sprintf("patch operation %d: %v", i, e))
+		}
+	}
+	return encodeStored(s)
+}
+
+// parsePointer splits an RFC 6901 json pointer into its unescaped tokens.
+func parsePointer(p string) ([]string, error) {
+	if len(p) == 0 {
+		return []string{}, nil
+	}
+	if p[0] != '/' {
+		return nil, errors.New("json pointer should start with /: " + p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// listIndex reads a pointer token as an index into the list of s, if s has a list. Only add may use "-", which is
+// the index just past the end.
+func listIndex(s storeValue, token string, add bool) (int, bool, error) {
+	if s.L == nil {
+		return 0, false, nil
+	}
+	if token == "-" && add {
+		return len(s.L), true, nil
+	}
+	i, e := strconv.Atoi(token)
+	if e != nil {
+		return 0, false, nil
+	}
+	max := len(s.L) - 1
+	if add {
+		max++
+	}
+	if i < 0 || i > max {
+		return 0, true, errors.New(fmt.Sprintf("index request out of range: %d vs %d", i, len(s.L)))
+	}
+	return i, true, nil
+}
+
+func pointerGet(s storeValue, path []string) (storeValue, error) {
+	for _, t := range path {
+		i, isList, e := listIndex(s, t, false)
+		if e != nil {
+			return s, e
+		}
+		if isList {
+			s = s.L[i]
+			continue
+		}
+		v, ok := s.M[t]
+		if !ok {
+			return s, errors.New("map key miss " + t)
+		}
+		s = v
+	}
+	return s, nil
+}
+
+// pointerAdd inserts v into a list, or sets it at a map key, at the end of the path.
+func pointerAdd(s storeValue, path []string, v storeValue) (storeValue, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	t := path[0]
+	i, isList, e := listIndex(s, t, len(path) == 1)
+	if e != nil {
+		return s, e
+	}
+	if len(path) == 1 {
+		if isList {
+			s.L = append(s.L[:i:i], append([]storeValue{v}, s.L[i:]...)...)
+			return s.capped(), nil
+		}
+		if s.M == nil {
+			s.M = map[string]storeValue{}
+		}
+		s.M[t] = v
+		return s, nil
+	}
+	if isList {
+		nv, e := pointerAdd(s.L[i], path[1:], v)
+		if e != nil {
+			return s, e
+		}
+		s.L[i] = nv
+		return s, nil
+	}
+	nv, ok := s.M[t]
+	if !ok {
+		return s, errors.New("map key miss " + t)
+	}
+	nv, e = pointerAdd(nv, path[1:], v)
+	if e != nil {
+		return s, e
+	}
+	s.M[t] = nv
+	return s, nil
+}
+
+// pointerRemove deletes the value at the end of the path, returning it.
+func pointerRemove(s storeValue, path []string) (storeValue, storeValue, error) {
+	if len(path) == 0 {
+		return storeValue{}, s, nil
+	}
+	t := path[0]
+	i, isList, e := listIndex(s, t, false)
+	if e != nil {
+		return s, s, e
+	}
+	if isList {
+		if len(path) == 1 {
+			v := s.L[i]
+			s.L = append(s.L[:i:i], s.L[i+1:]...)
+			return s, v, nil
+		}
+		nv, v, e := pointerRemove(s.L[i], path[1:])
+		if e != nil {
+			return s, v, e
+		}
+		s.L[i] = nv
+		return s, v, nil
+	}
+	nv, ok := s.M[t]
+	if !ok {
+		return s, s, errors.New("map key miss " + t)
+	}
+	if len(path) == 1 {
+		delete(s.M, t)
+		return s, nv, nil
+	}
+	nv, v, e := pointerRemove(nv, path[1:])
+	if e != nil {
+		return s, v, e
+	}
+	s.M[t] = nv
+	return s, v, nil
+}
+
+// Merge deep merges the trailing json document into the value at the given key and path, as RFC 7386 describes.
+func (db *Db) Merge(r ...string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.merge(r...)
+}
+
+func (db *Db) merge(r ...string) error {
+	gr := []string{"merge"}
+	gr = append(gr, r...)
+	c, e := parseCommand(gr)
+	if e != nil {
+		db.logM("errormerge", e.Error())
+		return e
+	}
+	db.expireIfDue(c.top_key)
+	v, e := handleMerge(db.d[c.top_key], c)
+	if e != nil {
+		db.logM("errormerge", e.Error())
+		return e
+	}
+	db.write(c.top_key, v)
+	db.logM("merge", r...)
+	return nil
+}
+
+// Patch atomically applies an RFC 6902 json patch to the value of a top key: either every operation applies, or
+// none of them does.
+func (db *Db) Patch(key, patch string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.patch(key, patch)
+}
+
+func (db *Db) patch(key, patch string) error {
+	db.expireIfDue(key)
+	v, e := handlePatch(db.d[key], patch)
+	if e != nil {
+		db.logM("errorpatch", e.Error())
+		return e
+	}
+	db.write(key, v)
+	db.logM("patch", key, patch)
+	return nil
+}
+
+// Merge deep merges any value which encoding/json can marshal into the value of a top key.
+func (c *Client) Merge(key string, v interface{}) error {
+	b, e := json.Marshal(v)
+	if e != nil {
+		return e
+	}
+	_, e = c.request("merge", key, string(b))
+	return e
+}
+
+// Patch atomically applies the json patch operations to the value of a top key.
+func (c *Client) Patch(key string, ops ...PatchOperation) error {
+	b, e := json.Marshal(ops)
+	if e != nil {
+		return e
+	}
+	_, e = c.request("patch", key, string(b))
+	return e
+}
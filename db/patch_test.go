@@ -0,0 +1,89 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.Nil(t, db.SetJSON("user", `{"name":"jack","profile":{"age":30,"city":"paris"},"tags":["a"]}`))
+	assert.Nil(t, db.Merge("user", `{"profile":{"age":null,"city":"rome"},"tags":["b"],"email":"j@x"}`))
+	v, e := db.GetJSON("user")
+	assert.Nil(t, e)
+	assert.Equal(t, `{"email":"j@x","name":"jack","profile":{"city":"rome"},"tags":["b"]}`, v)
+	assert.Nil(t, db.Merge("user", "->", "profile", `{"zip":"00100"}`))
+	assert.Nil(t, db.Merge("user", "->", "name", `"jill"`))
+	assert.NotNil(t, db.Merge("user", `{"broken"`))
+	db.Get("user")
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	v, e = db.GetJSON("user")
+	assert.Nil(t, e)
+	assert.Equal(t, `{"email":"j@x","name":"jill","profile":{"city":"rome","zip":"00100"},"tags":["b"]}`, v)
+}
+
+func TestPatch(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	assert.Nil(t, db.SetJSON("doc", `{"a/b":1,"list":["x","z"],"m":{"k":"v"}}`))
+	assert.Nil(t, db.Patch("doc", `[
+		{"op":"test","path":"/a~1b","value":1},
+		{"op":"add","path":"/list/1","value":"y"},
+		{"op":"add","path":"/list/-","value":"end"},
+		{"op":"replace","path":"/m/k","value":"w"},
+		{"op":"copy","from":"/m","path":"/n"},
+		{"op":"move","from":"/list/0","path":"/first"},
+		{"op":"remove","path":"/a~1b"}
+	]`))
+	v, e := db.GetJSON("doc")
+	assert.Nil(t, e)
+	assert.Equal(t, `{"first":"x","list":["y","z","end"],"m":{"k":"w"},"n":{"k":"w"}}`, v)
+	assert.NotNil(t, db.Patch("doc", `[{"op":"remove","path":"/first"},{"op":"test","path":"/m/k","value":"v"}]`))
+	assert.NotNil(t, db.Patch("doc", `[{"op":"remove","path":"/first"},{"op":"replace","path":"/missing","value":1}]`))
+	assert.NotNil(t, db.Patch("doc", `[{"op":"add","path":"/list/9","value":1}]`))
+	assert.NotNil(t, db.Patch("doc", `[{"op":"swap","path":"/first"}]`))
+	v, e = db.GetJSON("doc", "->", "first")
+	assert.Nil(t, e)
+	assert.Equal(t, `"x"`, v)
+	assert.Nil(t, db.Patch("doc", `[{"op":"remove","path":"/n"}]`))
+	db.Get("doc")
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	v, e = db.GetJSON("doc")
+	assert.Nil(t, e)
+	assert.Equal(t, `{"first":"x","list":["y","z","end"],"m":{"k":"w"}}`, v)
+}
+
+func TestClientMergePatch(t *testing.T) {
+	db, e := NewDb(DbOptionsTest())
+	defer db.Close()
+	assert.Nil(t, e)
+	c, e := NewClient(DefaultClientOptions())
+	defer c.Close()
+	assert.Nil(t, e)
+	assert.Nil(t, c.Merge("a", map[string]interface{}{"x": "1", "y": []string{"p"}}))
+	assert.Nil(t, c.Patch("a",
+		PatchOperation{Op: "add", Path: "/y/-", Value: "q"},
+		PatchOperation{Op: "move", From: "/x", Path: "/z"}))
+	v, e := c.Get("a", "->", "y", "+", "1")
+	assert.Nil(t, e)
+	assert.Equal(t, "q", v)
+	v, e = c.Get("a", "->", "z")
+	assert.Nil(t, e)
+	assert.Equal(t, "1", v)
+	assert.NotNil(t, c.Patch("a", PatchOperation{Op: "test", Path: "/z", Value: "2"}))
+	assert.Nil(t, c.Patch("a", PatchOperation{Op: "replace", Path: "/z", Value: nil}))
+	z := interface{}("not null")
+	assert.Nil(t, c.GetJSON("a", &z, "->", "z"))
+	assert.Nil(t, z)
+}
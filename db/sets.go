@@ -0,0 +1,218 @@
+package db
+
+import (
+	"sort"
+	"strconv"
+)
+
+// hasMember reports whether the set of s holds the member.
+func (s storeValue) hasMember(member string) bool {
+	i := sort.SearchStrings(s.S, member)
+	return i < len(s.S) && s.S[i] == member
+}
+
+// handleSetMember adds the command's member to the set at the command's path, or removes it, keeping the members
+// in order. It returns the new stored value and whether the set changed.
+func handleSetMember(previous string, c *command, add bool) (string, bool, error) {
+	changed := false
+	s, e := changeMapValue(decodeStored(previous), c.pos, func(n storeValue) (storeValue, error) {
+		i := sort.SearchStrings(n.S, c.set_value)
+		found := i < len(n.S) && n.S[i] == c.set_value
+		switch {
+		case add && !found:
+			n.S = append(n.S[:i:i], append([]string{c.set_value}, n.S[i:]...)...)
+			changed = true
+		case !add && found:
+			n.S = append(n.S[:i:i], n.S[i+1:]...)
+			changed = true
+		}
+		return n, nil
+	})
+	if e != nil {
+		return "", false, e
+	}
+	v, e := encodeStored(s)
+	return v, changed, e
+}
+
+// SAdd adds the trailing member to the set at the given key and path, reporting whether it was not there yet.
+func (db *Db) SAdd(r ...string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.setMember("sadd", r...)
+}
+
+// SRem removes the trailing member from the set at the given key and path, reporting whether it was there.
+func (db *Db) SRem(r ...string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.setMember("srem", r...)
+}
+
+func (db *Db) setMember(name string, r ...string) (bool, error) {
+	gr := []string{name}
+	gr = append(gr, r...)
+	c, e := parseCommand(gr)
+	if e != nil {
+		db.logM("error"+name, e.Error())
+		return false, e
+	}
+	db.expireIfDue(c.top_key)
+	v, changed, e := handleSetMember(db.d[c.top_key], c, name == "sadd")
+	if e != nil {
+		db.logM("error"+name, e.Error())
+		return false, e
+	}
+	if !changed {
+		return false, nil
+	}
+	db.write(c.top_key, v)
+	db.logM(name, r...)
+	return true, nil
+}
+
+// members returns the value at the path of a parsed set or sorted set read. A missing key or path holds an empty
+// value.
+func (db *Db) members(name string, r ...string) (storeValue, *command, error) {
+	gr := []string{name}
+	gr = append(gr, r...)
+	c, e := parseCommand(gr)
+	if e != nil {
+		db.logM("error"+name, e.Error())
+		return storeValue{}, c, e
+	}
+	db.expireIfDue(c.top_key)
+	existing, ok := db.d[c.top_key]
+	if !ok {
+		return storeValue{}, c, nil
+	}
+	s, e := valueAt(decodeStored(existing), c.pos)
+	if e != nil {
+		return storeValue{}, c, nil
+	}
+	return s, c, nil
+}
+
+// SIsMember reports whether the set at the given key and path holds the trailing member.
+func (db *Db) SIsMember(r ...string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.sIsMember(r...)
+}
+
+func (db *Db) sIsMember(r ...string) (bool, error) {
+	s, c, e := db.members("sismember", r...)
+	if e != nil {
+		return false, e
+	}
+	return s.hasMember(c.set_value), nil
+}
+
+// SMembers returns the members of the set at the given key and path, in order.
+func (db *Db) SMembers(r ...string) ([]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	s, _, e := db.members("smembers", r...)
+	return append([]string{}, s.S...), e
+}
+
+// SCard returns the number of members of the set at the given key and path.
+func (db *Db) SCard(r ...string) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	s, _, e := db.members("scard", r...)
+	return len(s.S), e
+}
+
+// SUnion returns the members found in any of the sets held by the top keys, in order.
+func (db *Db) SUnion(keys ...string) []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.combine(keys, false)
+}
+
+// SInter returns the members found in all of the sets held by the top keys, in order.
+func (db *Db) SInter(keys ...string) []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.combine(keys, true)
+}
+
+// combine counts how many of the sets held by the top keys hold each member, keeping the members found in any of
+// them, or in all of them.
+func (db *Db) combine(keys []string, all bool) []string {
+	counts := map[string]int{}
+	for _, k := range keys {
+		s, _, _ := db.members("smembers", k)
+		for _, m := range s.S {
+			counts[m]++
+		}
+	}
+	members := []string{}
+	for m, n := range counts {
+		if !all || n == len(keys) {
+			members = append(members, m)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// SAdd adds the trailing member to the set at the given key and path, reporting whether it was not there yet.
+func (c *Client) SAdd(command ...string) (bool, error) {
+	return c.setFlag("sadd", command)
+}
+
+// SRem removes the trailing member from the set at the given key and path, reporting whether it was there.
+func (c *Client) SRem(command ...string) (bool, error) {
+	return c.setFlag("srem", command)
+}
+
+// SIsMember reports whether the set at the given key and path holds the trailing member.
+func (c *Client) SIsMember(command ...string) (bool, error) {
+	return c.setFlag("sismember", command)
+}
+
+func (c *Client) setFlag(name string, command []string) (bool, error) {
+	r, e := c.request(append([]string{name}, command...)...)
+	if e != nil {
+		return false, e
+	}
+	return strconv.ParseBool(r[1])
+}
+
+// SMembers returns the members of the set at the given key and path, in order.
+func (c *Client) SMembers(command ...string) ([]string, error) {
+	r, e := c.request(append([]string{"smembers"}, command...)...)
+	if e != nil {
+		return nil, e
+	}
+	return r[1:], nil
+}
+
+// SCard returns the number of members of the set at the given key and path.
+func (c *Client) SCard(command ...string) (int, error) {
+	r, e := c.request(append([]string{"scard"}, command...)...)
+	if e != nil {
+		return 0, e
+	}
+	return strconv.Atoi(r[1])
+}
+
+// SUnion returns the members found in any of the sets held by the top keys, in order.
+func (c *Client) SUnion(keys ...string) ([]string, error) {
+	r, e := c.request(append([]string{"sunion"}, keys...)...)
+	if e != nil {
+		return nil, e
+	}
+	return r[1:], nil
+}
+
+// SInter returns the members found in all of the sets held by the top keys, in order.
+func (c *Client) SInter(keys ...string) ([]string, error) {
+	r, e := c.request(append([]string{"sinter"}, keys...)...)
+	if e != nil {
+		return nil, e
+	}
+	return r[1:], nil
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSetMemberParse(t *testing.T) {
+	c, e := parseCommand([]string{"sadd", "post", "->", "likes", "jack"})
+	assert.Nil(t, e)
+	assert.Equal(t, c, &command{
+		ct:      command_sadd,
+		top_key: "post",
+		pos: []commandValue{
+			commandValue{
+				vt:  valueMap,
+				key: "likes",
+			},
+		},
+		set_value: "jack",
+	})
+	_, e = parseCommand([]string{"sadd", "post"})
+	assert.NotNil(t, e)
+	_, e = parseCommand([]string{"smembers", "post", "+", "+"})
+	assert.NotNil(t, e)
+	_, e = parseCommand([]string{"sismember", "post", "+", "+", "jack"})
+	assert.NotNil(t, e)
+}
+
+func TestHandleSetMember(t *testing.T) {
+	v := ""
+	for _, m := range []string{"jill", "jack", "jill", "bob"} {
+		c, e := parseCommand([]string{"sadd", "post", "->", "likes", m})
+		assert.Nil(t, e)
+		v, _, e = handleSetMember(v, c, true)
+		assert.Nil(t, e)
+	}
+	c, e := parseCommand([]string{"srem", "post", "->", "likes", "jack"})
+	assert.Nil(t, e)
+	v, changed, e := handleSetMember(v, c, false)
+	assert.Nil(t, e)
+	assert.True(t, changed)
+	_, changed, e = handleSetMember(v, c, false)
+	assert.Nil(t, e)
+	assert.False(t, changed)
+	cGet, e := parseCommand([]string{"getjson", "post"})
+	assert.Nil(t, e)
+	g, e := handleGetJson(v, cGet)
+	assert.Nil(t, e)
+	assert.Equal(t, `{"likes":["bob","jill"]}`, g)
+	cGet, e = parseCommand([]string{"get", "post", "->", "likes"})
+	assert.Nil(t, e)
+	g, e = handleGet(v, cGet)
+	assert.Nil(t, e)
+	assert.Equal(t, `{"V":"","L":null,"M":null,"S":["bob","jill"]}`, g)
+}
+
+func TestSets(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	for _, m := range []string{"jack", "jill", "jack"} {
+		_, e := db.SAdd("post:1", "->", "likes", m)
+		assert.Nil(t, e)
+	}
+	ok, e := db.SAdd("post:2", "jill")
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	ok, e = db.SAdd("post:2", "bob")
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	ok, e = db.SAdd("post:3", "jill")
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	ok, e = db.SRem("post:3", "jill")
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	ok, e = db.SIsMember("post:1", "->", "likes", "jill")
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	ok, e = db.SIsMember("missing", "->", "likes", "jill")
+	assert.Nil(t, e)
+	assert.False(t, ok)
+	n, e := db.SCard("post:1", "->", "likes")
+	assert.Nil(t, e)
+	assert.Equal(t, 2, n)
+	assert.Nil(t, db.Copy("post:1", "->", "likes", "to", "post:1"))
+	assert.Equal(t, []string{"bob", "jack", "jill"}, db.SUnion("post:1", "post:2", "post:3"))
+	assert.Equal(t, []string{"jill"}, db.SInter("post:1", "post:2"))
+	assert.Equal(t, []string{}, db.SInter("post:1", "post:3"))
+	db.Get("post:1")
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	m, e := db.SMembers("post:2")
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"bob", "jill"}, m)
+	m, e = db.SMembers("post:3")
+	assert.Nil(t, e)
+	assert.Equal(t, []string{}, m)
+	m, e = db.SMembers("post:1")
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"jack", "jill"}, m)
+}
+
+func TestClientSets(t *testing.T) {
+	db, e := NewDb(DbOptionsTest())
+	defer db.Close()
+	assert.Nil(t, e)
+	c, e := NewClient(DefaultClientOptions())
+	defer c.Close()
+	assert.Nil(t, e)
+	ok, e := c.SAdd("a", "x,y")
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	ok, e = c.SAdd("a", "x,y")
+	assert.Nil(t, e)
+	assert.False(t, ok)
+	ok, e = c.SAdd("b", "z")
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	ok, e = c.SIsMember("a", "x,y")
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	ok, e = c.SRem("a", "nope")
+	assert.Nil(t, e)
+	assert.False(t, ok)
+	n, e := c.SCard("a")
+	assert.Nil(t, e)
+	assert.Equal(t, 1, n)
+	m, e := c.SMembers("a")
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"x,y"}, m)
+	m, e = c.SUnion("a", "b")
+	assert.Nil(t, e)
+	assert.Equal(t, []string{"x,y", "z"}, m)
+	m, e = c.SInter("a", "b")
+	assert.Nil(t, e)
+	assert.Empty(t, m)
+	_, e = c.SUnion()
+	assert.NotNil(t, e)
+}
@@ -0,0 +1,323 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// ScoredMember is a member of a sorted set along with its score.
+type ScoredMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// zless orders the members of a sorted set by score, and then by member.
+func zless(a, b ScoredMember) bool {
+	return a.Score < b.Score || (a.Score == b.Score && a.Member < b.Member)
+}
+
+// zindex returns the position of a member in the sorted set of s, or -1.
+func (s storeValue) zindex(member string) int {
+	for i, m := range s.Z {
+		if m.Member == member {
+			return i
+		}
+	}
+	return -1
+}
+
+// zput sets the score of a member of the sorted set of s, moving it to its new position.
+func (s storeValue) zput(member string, score float64) storeValue {
+	z := make([]ScoredMember, 0, len(s.Z)+1)
+	for _, m := range s.Z {
+		if m.Member != member {
+			z = append(z, m)
+		}
+	}
+	m := ScoredMember{member, score}
+	i := sort.Search(len(z), func(i int) bool { return zless(m, z[i]) })
+	s.Z = append(z[:i:i], append([]ScoredMember{m}, z[i:]...)...)
+	return s
+}
+
+func parseScore(v string) (float64, error) {
+	f, e := strconv.ParseFloat(v, 64)
+	if e != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, errors.New("score should be a finite number, saw " + v)
+	}
+	return f, nil
+}
+
+func formatScore(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// handleZWrite sets the score of the command's member in the sorted set at the command's path, or adds to it when
+// incr is set. It returns the new stored value, the member's new score, and whether the member is new.
+func handleZWrite(previous string, c *command, incr bool) (string, float64, bool, error) {
+	score, e := parseScore(c.args[1])
+	if e != nil {
+		return "", 0, false, e
+	}
+	member := c.args[0]
+	added := false
+	s, e := changeMapValue(decodeStored(previous), c.pos, func(n storeValue) (storeValue, error) {
+		i := n.zindex(member)
+		added = i < 0
+		if incr && !added {
+			score += n.Z[i].Score
+		}
+		if math.IsInf(score, 0) {
+			return n, errors.New("score overflows")
+		}
+		return n.zput(member, score), nil
+	})
+	if e != nil {
+		return "", 0, false, e
+	}
+	v, e := encodeStored(s)
+	return v, score, added, e
+}
+
+// zrank returns the rank of a member in a sorted set, counting from the lowest score, or the highest in reverse.
+func zrank(s storeValue, member string, reverse bool) (int, error) {
+	i := s.zindex(member)
+	if i < 0 {
+		return 0, errors.New("sorted set member miss " + member)
+	}
+	if reverse {
+		return len(s.Z) - 1 - i, nil
+	}
+	return i, nil
+}
+
+// zrange returns the members of a sorted set from rank start to rank stop, both included, where negative ranks
+// count back from the last member.
+func zrange(s storeValue, start, stop string, reverse bool) ([]ScoredMember, error) {
+	from, e := strconv.Atoi(start)
+	if e != nil {
+		return nil, e
+	}
+	to, e := strconv.Atoi(stop)
+	if e != nil {
+		return nil, e
+	}
+	n := len(s.Z)
+	if from < 0 {
+		from += n
+	}
+	if to < 0 {
+		to += n
+	}
+	if from < 0 {
+		from = 0
+	}
+	if to >= n {
+		to = n - 1
+	}
+	z := []ScoredMember{}
+	for i := from; i <= to; i++ {
+		if reverse {
+			z = append(z, s.Z[n-1-i])
+		} else {
+			z = append(z, s.Z[i])
+		}
+	}
+	return z, nil
+}
+
+// zrangeByScore returns the members of a sorted set whose score is between min and max, both included, in order.
+// The bounds may be -inf and +inf.
+func zrangeByScore(s storeValue, min, max string) ([]ScoredMember, error) {
+	lo, e := strconv.ParseFloat(min, 64)
+	if e != nil {
+		return nil, e
+	}
+	hi, e := strconv.ParseFloat(max, 64)
+	if e != nil {
+		return nil, e
+	}
+	z := []ScoredMember{}
+	for _, m := range s.Z {
+		if m.Score >= lo && m.Score <= hi {
+			z = append(z, m)
+		}
+	}
+	return z, nil
+}
+
+// ZAdd sets the score of a member of the sorted set at the given key and path, given as the trailing member and
+// score. It reports whether the member is new.
+func (db *Db) ZAdd(r ...string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	_, added, e := db.zwrite("zadd", r...)
+	return added, e
+}
+
+// ZIncr adds the trailing delta to the score of the member preceding it in the sorted set at the given key and path,
+// returning the new score. A new member starts from zero.
+func (db *Db) ZIncr(r ...string) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	score, _, e := db.zwrite("zincr", r...)
+	return score, e
+}
+
+func (db *Db) zwrite(name string, r ...string) (string, bool, error) {
+	gr := []string{name}
+	gr = append(gr, r...)
+	c, e := parseCommand(gr)
+	if e != nil {
+		db.logM("error"+name, e.Error())
+		return "", false, e
+	}
+	db.expireIfDue(c.top_key)
+	v, score, added, e := handleZWrite(db.d[c.top_key], c, name == "zincr")
+	if e != nil {
+		db.logM("error"+name, e.Error())
+		return "", false, e
+	}
+	db.write(c.top_key, v)
+	db.logM(name, r...)
+	return formatScore(score), added, nil
+}
+
+// ZRank returns the rank of the trailing member in the sorted set at the given key and path, counting from zero for
+// the lowest score.
+func (db *Db) ZRank(r ...string) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.zrank("zrank", r...)
+}
+
+// ZRevRank is like ZRank, but counts from zero for the highest score.
+func (db *Db) ZRevRank(r ...string) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.zrank("zrevrank", r...)
+}
+
+func (db *Db) zrank(name string, r ...string) (int, error) {
+	s, c, e := db.members(name, r...)
+	if e != nil {
+		return 0, e
+	}
+	return zrank(s, c.args[0], name == "zrevrank")
+}
+
+// ZRange returns the members of the sorted set at the given key and path from the trailing start rank to the
+// trailing stop rank, both included, from the lowest score. Negative ranks count back from the last member.
+func (db *Db) ZRange(r ...string) ([]ScoredMember, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.zrange("zrange", r...)
+}
+
+// ZRevRange is like ZRange, but ranks from the highest score.
+func (db *Db) ZRevRange(r ...string) ([]ScoredMember, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.zrange("zrevrange", r...)
+}
+
+// ZRangeByScore returns the members of the sorted set at the given key and path whose score is between the trailing
+// min and max, both included, from the lowest score.
+func (db *Db) ZRangeByScore(r ...string) ([]ScoredMember, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.zrange("zrangebyscore", r...)
+}
+
+func (db *Db) zrange(name string, r ...string) ([]ScoredMember, error) {
+	s, c, e := db.members(name, r...)
+	if e != nil {
+		return nil, e
+	}
+	if name == "zrangebyscore" {
+		return zrangeByScore(s, c.args[0], c.args[1])
+	}
+	return zrange(s, c.args[0], c.args[1], name == "zrevrange")
+}
+
+// scoredReply lists scored members as alternating members and scores.
+func scoredReply(z []ScoredMember) []string {
+	reply := []string{"ok"}
+	for _, m := range z {
+		reply = append(reply, m.Member, formatScore(m.Score))
+	}
+	return reply
+}
+
+// ZAdd sets the score of the member preceding the trailing score, reporting whether the member is new.
+func (c *Client) ZAdd(command ...string) (bool, error) {
+	r, e := c.request(append([]string{"zadd"}, command...)...)
+	if e != nil {
+		return false, e
+	}
+	return strconv.ParseBool(r[1])
+}
+
+// ZIncr adds the trailing delta to the score of the member preceding it, returning the new score.
+func (c *Client) ZIncr(command ...string) (string, error) {
+	r, e := c.request(append([]string{"zincr"}, command...)...)
+	if e != nil {
+		return "", e
+	}
+	return r[1], nil
+}
+
+// ZRank returns the rank of the trailing member, counting from zero for the lowest score.
+func (c *Client) ZRank(command ...string) (int, error) {
+	return c.zrank("zrank", command)
+}
+
+// ZRevRank returns the rank of the trailing member, counting from zero for the highest score.
+func (c *Client) ZRevRank(command ...string) (int, error) {
+	return c.zrank("zrevrank", command)
+}
+
+func (c *Client) zrank(name string, command []string) (int, error) {
+	r, e := c.request(append([]string{name}, command...)...)
+	if e != nil {
+		return 0, e
+	}
+	return strconv.Atoi(r[1])
+}
+
+// ZRange returns the members from the trailing start rank to the trailing stop rank, from the lowest score.
+func (c *Client) ZRange(command ...string) ([]ScoredMember, error) {
+	return c.zrange("zrange", command)
+}
+
+// ZRevRange returns the members from the trailing start rank to the trailing stop rank, from the highest score.
+func (c *Client) ZRevRange(command ...string) ([]ScoredMember, error) {
+	return c.zrange("zrevrange", command)
+}
+
+// ZRangeByScore returns the members whose score is between the trailing min and max, from the lowest score.
+func (c *Client) ZRangeByScore(command ...string) ([]ScoredMember, error) {
+	return c.zrange("zrangebyscore", command)
+}
+
+func (c *Client) zrange(name string, command []string) ([]ScoredMember, error) {
+	r, e := c.request(append([]string{name}, command...)...)
+	if e != nil {
+		return nil, e
+	}
+	if len(r)%2 != 1 {
+		return nil, errors.New(fmt.Sprintf("%s reply should hold members and scores, saw %v", name, r))
+	}
+	z := make([]ScoredMember, 0, len(r)/2)
+	for i := 1; i < len(r); i += 2 {
+		f, e := strconv.ParseFloat(r[i+1], 64)
+		if e != nil {
+			return nil, e
+		}
+		z = append(z, ScoredMember{r[i], f})
+	}
+	return z, nil
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSortedSetParse(t *testing.T) {
+	c, e := parseCommand([]string{"zadd", "post", "->", "top", "jack", "2.5"})
+	assert.Nil(t, e)
+	assert.Equal(t, c, &command{
+		ct:      command_zadd,
+		top_key: "post",
+		pos: []commandValue{
+			commandValue{
+				vt:  valueMap,
+				key: "top",
+			},
+		},
+		args: []string{"jack", "2.5"},
+	})
+	_, e = parseCommand([]string{"zadd", "post", "jack"})
+	assert.NotNil(t, e)
+	_, e = parseCommand([]string{"zrange", "post", "+", "+", "0", "1"})
+	assert.NotNil(t, e)
+}
+
+func TestHandleZWrite(t *testing.T) {
+	v := ""
+	for _, r := range [][]string{{"zadd", "b", "2"}, {"zadd", "a", "2"}, {"zadd", "c", "1"}, {"zincr", "c", "1.5"}} {
+		c, e := parseCommand([]string{r[0], "post", "->", "top", r[1], r[2]})
+		assert.Nil(t, e)
+		v, _, _, e = handleZWrite(v, c, r[0] == "zincr")
+		assert.Nil(t, e)
+	}
+	c, e := parseCommand([]string{"zadd", "post", "->", "top", "a", "NaN"})
+	assert.Nil(t, e)
+	_, _, _, e = handleZWrite(v, c, false)
+	assert.NotNil(t, e)
+	cGet, e := parseCommand([]string{"getjson", "post", "->", "top"})
+	assert.Nil(t, e)
+	g, e := handleGetJson(v, cGet)
+	assert.Nil(t, e)
+	assert.Equal(t, `[{"member":"a","score":2},{"member":"b","score":2},{"member":"c","score":2.5}]`, g)
+}
+
+func TestSortedSets(t *testing.T) {
+	o := DbOptionsTest()
+	db, e := NewDb(o)
+	assert.Nil(t, e)
+	for _, m := range [][]string{{"c1", "5"}, {"c2", "9"}, {"c3", "1"}, {"c4", "7"}} {
+		added, e := db.ZAdd("thread", "->", "top", m[0], m[1])
+		assert.Nil(t, e)
+		assert.True(t, added)
+	}
+	added, e := db.ZAdd("thread", "->", "top", "c3", "3")
+	assert.Nil(t, e)
+	assert.False(t, added)
+	score, e := db.ZIncr("thread", "->", "top", "c1", "5")
+	assert.Nil(t, e)
+	assert.Equal(t, "10", score)
+	_, e = db.ZIncr("thread", "->", "top", "c1", "x")
+	assert.NotNil(t, e)
+	rank, e := db.ZRevRank("thread", "->", "top", "c1")
+	assert.Nil(t, e)
+	assert.Equal(t, 0, rank)
+	rank, e = db.ZRank("thread", "->", "top", "c1")
+	assert.Nil(t, e)
+	assert.Equal(t, 3, rank)
+	_, e = db.ZRank("thread", "->", "top", "c9")
+	assert.NotNil(t, e)
+	top, e := db.ZRevRange("thread", "->", "top", "0", "1")
+	assert.Nil(t, e)
+	assert.Equal(t, []ScoredMember{{"c1", 10}, {"c2", 9}}, top)
+	z, e := db.ZRange("thread", "->", "top", "-2", "-1")
+	assert.Nil(t, e)
+	assert.Equal(t, []ScoredMember{{"c2", 9}, {"c1", 10}}, z)
+	z, e = db.ZRange("thread", "->", "top", "5", "9")
+	assert.Nil(t, e)
+	assert.Equal(t, []ScoredMember{}, z)
+	z, e = db.ZRangeByScore("thread", "->", "top", "3", "9")
+	assert.Nil(t, e)
+	assert.Equal(t, []ScoredMember{{"c3", 3}, {"c4", 7}, {"c2", 9}}, z)
+	z, e = db.ZRangeByScore("missing", "-inf", "+inf")
+	assert.Nil(t, e)
+	assert.Equal(t, []ScoredMember{}, z)
+	db.Get("thread")
+	db.Close()
+	o.Overwrite = false
+	db, e = NewDb(o)
+	defer db.Close()
+	assert.Nil(t, e)
+	z, e = db.ZRange("thread", "->", "top", "0", "-1")
+	assert.Nil(t, e)
+	assert.Equal(t, []ScoredMember{{"c3", 3}, {"c4", 7}, {"c2", 9}, {"c1", 10}}, z)
+}
+
+func TestClientSortedSets(t *testing.T) {
+	db, e := NewDb(DbOptionsTest())
+	defer db.Close()
+	assert.Nil(t, e)
+	c, e := NewClient(DefaultClientOptions())
+	defer c.Close()
+	assert.Nil(t, e)
+	added, e := c.ZAdd("board", "jack", "10")
+	assert.Nil(t, e)
+	assert.True(t, added)
+	score, e := c.ZIncr("board", "jill", "12.5")
+	assert.Nil(t, e)
+	assert.Equal(t, "12.5", score)
+	rank, e := c.ZRevRank("board", "jill")
+	assert.Nil(t, e)
+	assert.Equal(t, 0, rank)
+	rank, e = c.ZRank("board", "jill")
+	assert.Nil(t, e)
+	assert.Equal(t, 1, rank)
+	z, e := c.ZRevRange("board", "0", "-1")
+	assert.Nil(t, e)
+	assert.Equal(t, []ScoredMember{{"jill", 12.5}, {"jack", 10}}, z)
+	z, e = c.ZRange("board", "0", "0")
+	assert.Nil(t, e)
+	assert.Equal(t, []ScoredMember{{"jack", 10}}, z)
+	z, e = c.ZRangeByScore("board", "11", "+inf")
+	assert.Nil(t, e)
+	assert.Equal(t, []ScoredMember{{"jill", 12.5}}, z)
+	_, e = c.ZRank("board", "bob")
+	assert.NotNil(t, e)
+}